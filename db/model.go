@@ -19,12 +19,209 @@ type User struct {
 type OnCallSchedule struct {
 	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
+	StartTime time.Time `json:"start_time"` // Returned in UTC
+	EndTime   time.Time `json:"end_time"`   // Returned in UTC
+	TimeZone  string    `json:"time_zone"`  // IANA zone the shift was planned in
+	TeamID    string    `json:"team_id,omitempty"`
 	IsActive  bool      `json:"is_active"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Team owns schedules and receives the alerts routed to it. Members are the
+// users whose team is the team name.
+type Team struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	EscalationPolicyID string    `json:"escalation_policy_id,omitempty"` // Used for the team's alerts
+	IsActive           bool      `json:"is_active"`
+	Members            []User    `json:"members,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type TeamRequest struct {
+	Name               string `json:"name" binding:"required"`
+	Description        string `json:"description"`
+	EscalationPolicyID string `json:"escalation_policy_id"`
+}
+
+// RoutingRule sends new alerts matching a source, label or API key to a team
+type RoutingRule struct {
+	ID         string    `json:"id"`
+	TeamID     string    `json:"team_id"`
+	MatchType  string    `json:"match_type"`          // source, label, api_key
+	MatchKey   string    `json:"match_key,omitempty"` // Label name, only for label rules
+	MatchValue string    `json:"match_value"`         // Source, label value or API key ID
+	Priority   int       `json:"priority"`            // Lowest is evaluated first
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type RoutingRuleRequest struct {
+	MatchType  string `json:"match_type" binding:"required,oneof=source label api_key"`
+	MatchKey   string `json:"match_key"`
+	MatchValue string `json:"match_value" binding:"required"`
+	Priority   *int   `json:"priority"` // Defaults to 100
+}
+
+// Routing rule match types
+const (
+	RouteMatchSource = "source"
+	RouteMatchLabel  = "label"
+	RouteMatchAPIKey = "api_key"
+)
+
+// CoverageReport lists the stretches of time nobody is on call and the
+// hand-entered shifts that overlap
+type CoverageReport struct {
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	RotationID string            `json:"rotation_id,omitempty"` // Empty checks the team or default on-call
+	TeamID     string            `json:"team_id,omitempty"`
+	Gaps       []TimeRange       `json:"gaps"`
+	Overlaps   []ScheduleOverlap `json:"overlaps"`
+}
+
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type ScheduleOverlap struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	ScheduleIDs []string  `json:"schedule_ids"`
+	UserIDs     []string  `json:"user_ids"`
+}
+
+// CalendarImportResult reports what an ICS import created and skipped
+type CalendarImportResult struct {
+	Created []OnCallSchedule     `json:"created"`
+	Skipped []CalendarImportSkip `json:"skipped"`
+}
+
+type CalendarImportSkip struct {
+	UID     string `json:"uid"`
+	Summary string `json:"summary"`
+	Reason  string `json:"reason"`
+}
+
+// Rotation is a recurring on-call schedule made of layers
+type Rotation struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	TimeZone    string          `json:"time_zone"` // IANA zone, e.g. Asia/Ho_Chi_Minh
+	TeamID      string          `json:"team_id,omitempty"`
+	IsActive    bool            `json:"is_active"`
+	Layers      []RotationLayer `json:"layers"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type RotationLayer struct {
+	ID               string   `json:"id"`
+	RotationID       string   `json:"rotation_id"`
+	LayerNumber      int      `json:"layer_number"` // Higher layers win
+	Name             string   `json:"name"`
+	Participants     []string `json:"participants"`                 // Ordered user IDs
+	ShiftType        string   `json:"shift_type"`                   // daily, weekly, custom
+	ShiftLengthHours int      `json:"shift_length_hours,omitempty"` // Only for custom shifts
+	HandoffTime      string   `json:"handoff_time"`                 // HH:MM in the rotation time zone
+	StartDate        string   `json:"start_date"`                   // YYYY-MM-DD of the first handoff
+}
+
+type RotationLayerRequest struct {
+	Name             string   `json:"name"`
+	Participants     []string `json:"participants" binding:"required,min=1"`
+	ShiftType        string   `json:"shift_type" binding:"required,oneof=daily weekly custom"`
+	ShiftLengthHours int      `json:"shift_length_hours" binding:"min=0"`
+	HandoffTime      string   `json:"handoff_time"`
+	StartDate        string   `json:"start_date" binding:"required"`
+}
+
+type RotationRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	TimeZone    string                 `json:"time_zone"`
+	TeamID      string                 `json:"team_id"`
+	Layers      []RotationLayerRequest `json:"layers" binding:"required,min=1,dive"` // Lowest layer first
+}
+
+// Shift is a computed stretch of time one user is on call
+type Shift struct {
+	UserID     string    `json:"user_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Layer      int       `json:"layer"`                 // 0 for overrides
+	OverrideID string    `json:"override_id,omitempty"` // Set when an override put the user on call
+}
+
+// ScheduleOverride puts a user on top of a rotation for a time range
+type ScheduleOverride struct {
+	ID          string     `json:"id"`
+	RotationID  string     `json:"rotation_id"`
+	UserID      string     `json:"user_id"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	Reason      string     `json:"reason,omitempty"`
+	SwapID      string     `json:"swap_id,omitempty"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CancelledBy string     `json:"cancelled_by,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+type ScheduleOverrideRequest struct {
+	UserID    string    `json:"user_id" binding:"required"`
+	StartTime time.Time `json:"start_time" binding:"required"`
+	EndTime   time.Time `json:"end_time" binding:"required"`
+	Reason    string    `json:"reason"`
+}
+
+// ShiftSwap is a proposal to hand a shift to another engineer, optionally
+// taking one of theirs in return
+type ShiftSwap struct {
+	ID            string     `json:"id"`
+	RotationID    string     `json:"rotation_id"`
+	RequesterID   string     `json:"requester_id"`
+	TargetUserID  string     `json:"target_user_id"`
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       time.Time  `json:"end_time"`
+	SwapStartTime *time.Time `json:"swap_start_time,omitempty"`
+	SwapEndTime   *time.Time `json:"swap_end_time,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	Status        string     `json:"status"` // pending, accepted, declined, cancelled
+	RespondedBy   string     `json:"responded_by,omitempty"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ShiftSwapRequest struct {
+	RotationID    string     `json:"rotation_id" binding:"required"`
+	TargetUserID  string     `json:"target_user_id" binding:"required"`
+	StartTime     time.Time  `json:"start_time" binding:"required"`
+	EndTime       time.Time  `json:"end_time" binding:"required"`
+	SwapStartTime *time.Time `json:"swap_start_time"`
+	SwapEndTime   *time.Time `json:"swap_end_time"`
+	Reason        string     `json:"reason"`
+}
+
+// Shift swap statuses
+const (
+	SwapStatusPending   = "pending"
+	SwapStatusAccepted  = "accepted"
+	SwapStatusDeclined  = "declined"
+	SwapStatusCancelled = "cancelled"
+)
+
+// Rotation shift types
+const (
+	ShiftTypeDaily  = "daily"
+	ShiftTypeWeekly = "weekly"
+	ShiftTypeCustom = "custom"
+)
+
 type Alert struct {
 	ID          string     `json:"id"`
 	Title       string     `json:"title"`
@@ -36,10 +233,49 @@ type Alert struct {
 	Source      string     `json:"source"`
 	AckedBy     string     `json:"acked_by,omitempty"`
 	AckedAt     *time.Time `json:"acked_at,omitempty"`
+	ResolvedBy  string     `json:"resolved_by,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	ClosedBy    string     `json:"closed_by,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
 	AssignedTo  string     `json:"assigned_to,omitempty"` // User ID
 	AssignedAt  *time.Time `json:"assigned_at,omitempty"`
+	TeamID      string     `json:"team_id,omitempty"`   // Team the alert was routed to
+	DedupKey    string     `json:"dedup_key,omitempty"` // Repeated events with this key update the open alert
+	Count       int        `json:"count"`               // Number of events folded into this alert
+	Author      string     `json:"author,omitempty"`    // User who raised the alert
+
+	// Free-form annotations
+	Tags    []string               `json:"tags"`
+	Details map[string]interface{} `json:"details"` // Key/value data, e.g. webhook metadata
+
+	// Escalation state
+	EscalationPolicyID string     `json:"escalation_policy_id,omitempty"`
+	EscalationLevel    int        `json:"escalation_level"`
+	EscalatedAt        *time.Time `json:"escalated_at,omitempty"`
+	SnoozedUntil       *time.Time `json:"snoozed_until,omitempty"` // Paging resumes at this time
+
+	// Grouping, a child alert never pages
+	ParentID string `json:"parent_id,omitempty"`
+	GroupKey string `json:"-"`
+
+	// Maintenance window the alert was raised in, it is then suppressed
+	MaintenanceWindowID string `json:"maintenance_window_id,omitempty"`
 }
 
+// Alert statuses. new and escalated alerts page, acked ones wait for the
+// responder, snoozed ones are reopened at snoozed_until, suppressed ones were
+// raised during a maintenance window and page nobody, resolved and closed
+// ones are done and can be reopened.
+const (
+	AlertStatusNew        = "new"
+	AlertStatusAcked      = "acked"
+	AlertStatusEscalated  = "escalated"
+	AlertStatusSnoozed    = "snoozed"
+	AlertStatusSuppressed = "suppressed"
+	AlertStatusResolved   = "resolved"
+	AlertStatusClosed     = "closed"
+)
+
 // AlertResponse includes user information for API responses
 type AlertResponse struct {
 	ID              string     `json:"id"`
@@ -52,12 +288,443 @@ type AlertResponse struct {
 	Source          string     `json:"source"`
 	AckedBy         string     `json:"acked_by,omitempty"`
 	AckedAt         *time.Time `json:"acked_at,omitempty"`
+	ResolvedBy      string     `json:"resolved_by,omitempty"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	ClosedBy        string     `json:"closed_by,omitempty"`
+	ClosedAt        *time.Time `json:"closed_at,omitempty"`
+	SnoozedUntil    *time.Time `json:"snoozed_until,omitempty"`
 	AssignedTo      string     `json:"assigned_to,omitempty"`       // User ID
 	AssignedToName  string     `json:"assigned_to_name,omitempty"`  // User Name
 	AssignedToEmail string     `json:"assigned_to_email,omitempty"` // User Email
 	AssignedAt      *time.Time `json:"assigned_at,omitempty"`
+	TeamID          string     `json:"team_id,omitempty"`
+	DedupKey        string     `json:"dedup_key,omitempty"`
+	Count           int        `json:"count"`
+	Author          string     `json:"author,omitempty"`
+
+	Tags    []string               `json:"tags"`
+	Details map[string]interface{} `json:"details"`
+
+	EscalationPolicyID string     `json:"escalation_policy_id,omitempty"`
+	EscalationLevel    int        `json:"escalation_level"`
+	EscalatedAt        *time.Time `json:"escalated_at,omitempty"`
+
+	ParentID   string `json:"parent_id,omitempty"` // Set on the alerts grouped under another
+	ChildCount int    `json:"child_count"`
+
+	MergedInto   string        `json:"merged_into,omitempty"`
+	MergedAlerts []MergedAlert `json:"merged_alerts,omitempty"` // Only on GET /alerts/:id
+
+	MaintenanceWindowID string `json:"maintenance_window_id,omitempty"`
+}
+
+// MergedAlert is an alert folded into another by a merge
+type MergedAlert struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Status   string    `json:"status"` // Status before the merge, restored by unmerge
+	Count    int       `json:"count"`
+	MergedAt time.Time `json:"merged_at"`
 }
 
+// AlertMergeRequest lists the alerts to merge into or split out of an alert
+type AlertMergeRequest struct {
+	AlertIDs []string `json:"alert_ids" binding:"required,min=1"`
+}
+
+// AlertList is one page of alerts. Pass NextCursor back as cursor to get
+// the next page; it is empty on the last page.
+type AlertList struct {
+	Alerts     []AlertResponse `json:"alerts"`
+	Total      int             `json:"total"` // Alerts matching the filters across all pages
+	Limit      int             `json:"limit"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// AlertActionResponse reports the outcome of an alert state transition
+type AlertActionResponse struct {
+	AlertID             string     `json:"alert_id"`
+	Status              string     `json:"status"`
+	EscalationCancelled bool       `json:"escalation_cancelled"`
+	EscalationScheduled bool       `json:"escalation_scheduled,omitempty"`
+	SnoozedUntil        *time.Time `json:"snoozed_until,omitempty"`
+}
+
+// AlertPolicy resolves or closes the alerts of a source and/or severity by
+// itself: stale policies once an alert had no update for StaleMinutes,
+// resolve_event policies when its source sends a resolve event for its
+// dedup key
+type AlertPolicy struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Source       string    `json:"source"`   // Empty matches every source
+	Severity     string    `json:"severity"` // Empty matches every severity
+	Trigger      string    `json:"trigger"`
+	Action       string    `json:"action"`
+	StaleMinutes int       `json:"stale_minutes,omitempty"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type AlertPolicyRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Source       string `json:"source"`
+	Severity     string `json:"severity"`
+	Trigger      string `json:"trigger" binding:"required,oneof=stale resolve_event"`
+	Action       string `json:"action" binding:"required,oneof=resolve close"`
+	StaleMinutes int    `json:"stale_minutes" binding:"min=0"`
+}
+
+// AlertGroupRule attaches a new alert to the open alert sharing its group
+// key, made of the rule and what it groups by: a label value, the uptime
+// service, the source, the AlertManager group key, or nothing for time
+// rules. The first rule giving a key wins, rules naming a source first.
+type AlertGroupRule struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Source        string    `json:"source"` // Empty matches every source
+	GroupBy       string    `json:"group_by"`
+	Label         string    `json:"label,omitempty"`
+	WindowMinutes int       `json:"window_minutes"` // Parents older than this take no children, 0 for no limit
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type AlertGroupRuleRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Source        string `json:"source"`
+	GroupBy       string `json:"group_by" binding:"required,oneof=label service source alertmanager_group time"`
+	Label         string `json:"label"`
+	WindowMinutes int    `json:"window_minutes" binding:"min=0"`
+}
+
+// What alert group rules group by
+const (
+	AlertGroupByLabel             = "label"
+	AlertGroupByService           = "service"
+	AlertGroupBySource            = "source"
+	AlertGroupByAlertManagerGroup = "alertmanager_group"
+	AlertGroupByTime              = "time"
+)
+
+// Alert policy triggers and actions
+const (
+	AlertPolicyStale        = "stale"
+	AlertPolicyResolveEvent = "resolve_event"
+
+	AlertPolicyResolve = "resolve"
+	AlertPolicyClose   = "close"
+)
+
+// Actions of POST /alerts/bulk
+const (
+	AlertBulkAck     = "ack"
+	AlertBulkResolve = "resolve"
+	AlertBulkClose   = "close"
+	AlertBulkAssign  = "assign"
+	AlertBulkTag     = "tag"
+)
+
+// AlertBulkRequest applies one action to the listed alerts, or to the alerts
+// matching the query parameters when IDs is empty
+type AlertBulkRequest struct {
+	Action string   `json:"action" binding:"required,oneof=ack resolve close assign tag"`
+	IDs    []string `json:"ids,omitempty"`
+	UserID string   `json:"user_id,omitempty"` // assign, or TeamID
+	TeamID string   `json:"team_id,omitempty"`
+	Tags   []string `json:"tags,omitempty"` // tag, added to the current tags
+}
+
+// AlertBulkResult is the outcome of a bulk action for one alert. Status is
+// the alert's status after a successful ack, resolve or close.
+type AlertBulkResult struct {
+	AlertID             string `json:"alert_id"`
+	OK                  bool   `json:"ok"`
+	Status              string `json:"status,omitempty"`
+	EscalationCancelled bool   `json:"escalation_cancelled,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+type AlertBulkResponse struct {
+	Action    string            `json:"action"`
+	Matched   int               `json:"matched"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []AlertBulkResult `json:"results"`
+}
+
+// AlertSnoozeRequest snoozes an alert for a duration ("2h", "90m") or until
+// a deadline, exactly one of them
+type AlertSnoozeRequest struct {
+	Duration string     `json:"duration,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// AlertEvent is one entry of an alert's timeline
+type AlertEvent struct {
+	ID        string    `json:"id"`
+	AlertID   string    `json:"alert_id"`
+	Action    string    `json:"action"`
+	ActorType string    `json:"actor_type"` // user, api_key, system
+	ActorID   string    `json:"actor_id,omitempty"`
+	ActorName string    `json:"actor_name,omitempty"` // Only for users
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AlertAssignRequest hands an alert to a user, or to a team and its current
+// on-call, exactly one of them
+type AlertAssignRequest struct {
+	UserID string `json:"user_id,omitempty"`
+	TeamID string `json:"team_id,omitempty"`
+}
+
+// AlertResponder is a user paged on an alert on top of its assignee
+type AlertResponder struct {
+	AlertID   string    `json:"alert_id"`
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	AddedBy   string    `json:"added_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AlertRespondersRequest struct {
+	UserIDs []string `json:"user_ids" binding:"required,min=1"`
+}
+
+// AlertNote is a comment left on an alert
+type AlertNote struct {
+	ID         string    `json:"id"`
+	AlertID    string    `json:"alert_id"`
+	AuthorID   string    `json:"author_id,omitempty"`
+	AuthorName string    `json:"author_name,omitempty"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type AlertNoteRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+type AlertTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// Alert event actors
+const (
+	ActorUser   = "user"
+	ActorAPIKey = "api_key"
+	ActorSystem = "system"
+	ActorPolicy = "policy" // Alert policy, actor_id is its ID
+)
+
+// Alert event actions
+const (
+	AlertEventCreated             = "created"
+	AlertEventDeduplicated        = "deduplicated"
+	AlertEventRouted              = "routed"
+	AlertEventAssigned            = "assigned"
+	AlertEventAcked               = "acked"
+	AlertEventUnacked             = "unacked"
+	AlertEventResolved            = "resolved"
+	AlertEventClosed              = "closed"
+	AlertEventReopened            = "reopened"
+	AlertEventSnoozed             = "snoozed"
+	AlertEventSnoozeEnded         = "snooze_ended"
+	AlertEventResponderAdded      = "responder_added"
+	AlertEventEscalationStarted   = "escalation_started"
+	AlertEventEscalated           = "escalated"
+	AlertEventEscalationExhausted = "escalation_exhausted"
+	AlertEventNotified            = "notified" // new_value is the delivery status
+	AlertEventNotificationReplay  = "notification_replayed"
+	AlertEventNoteAdded           = "note_added"
+	AlertEventNoteUpdated         = "note_updated"
+	AlertEventNoteDeleted         = "note_deleted"
+	AlertEventTagsChanged         = "tags_changed"
+	AlertEventDetailsChanged      = "details_changed"
+	AlertEventGrouped             = "grouped"     // On the child, new_value is the parent
+	AlertEventChildAdded          = "child_added" // On the parent, new_value is the child
+	AlertEventMerged              = "merged"      // On the merged alert, new_value is the target
+	AlertEventMergeAdded          = "merge_added" // On the target, new_value is the merged alert
+	AlertEventUnmerged            = "unmerged"    // On both, new_value is the other alert
+	AlertEventSuppressed          = "suppressed"  // new_value is the maintenance window
+	AlertEventUnsuppressed        = "unsuppressed"
+)
+
+// AlertStreamEvent is pushed to the clients of the alert stream each time
+// an alert changes. Alert is the alert after the change.
+type AlertStreamEvent struct {
+	Type    string        `json:"type"`
+	AlertID string        `json:"alert_id"`
+	Alert   AlertResponse `json:"alert"`
+	Event   AlertEvent    `json:"event"` // Timeline entry of the change
+}
+
+// Alert stream event types
+const (
+	AlertStreamCreated   = "created"
+	AlertStreamUpdated   = "updated"
+	AlertStreamAcked     = "acked"
+	AlertStreamEscalated = "escalated"
+	AlertStreamResolved  = "resolved"
+	AlertStreamClosed    = "closed"
+)
+
+// MaintenanceWindow is planned work during which the alerts it matches are
+// stored as suppressed and uptime checks open no incident. Every scope that
+// is set must match: one of the uptime services, one of the sources and all
+// of the labels. Recurring windows repeat StartsAt to EndsAt every day or
+// week at the same wall-clock time in TimeZone.
+type MaintenanceWindow struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ServiceIDs  []string          `json:"service_ids"`
+	Sources     []string          `json:"sources"`
+	Labels      map[string]string `json:"labels"`
+	StartsAt    time.Time         `json:"starts_at"` // First occurrence
+	EndsAt      time.Time         `json:"ends_at"`
+	Recurrence  string            `json:"recurrence,omitempty"` // daily, weekly, empty for one-off
+	TimeZone    string            `json:"time_zone"`
+	InProgress  bool              `json:"in_progress"` // An occurrence covers the current time
+	IsActive    bool              `json:"is_active"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type MaintenanceWindowRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	Description string            `json:"description"`
+	ServiceIDs  []string          `json:"service_ids"`
+	Sources     []string          `json:"sources"`
+	Labels      map[string]string `json:"labels"`
+	StartsAt    time.Time         `json:"starts_at" binding:"required"`
+	EndsAt      time.Time         `json:"ends_at" binding:"required"`
+	Recurrence  string            `json:"recurrence" binding:"omitempty,oneof=daily weekly"`
+	TimeZone    string            `json:"time_zone"` // Defaults to UTC
+}
+
+// Maintenance window recurrences
+const (
+	MaintenanceDaily  = "daily"
+	MaintenanceWeekly = "weekly"
+)
+
+// Escalation Models
+type EscalationPolicy struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Sources     []string          `json:"sources"`    // Alert sources this policy applies to
+	IsDefault   bool              `json:"is_default"` // Used when no source or service matches
+	IsActive    bool              `json:"is_active"`
+	Levels      []EscalationLevel `json:"levels"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type EscalationLevel struct {
+	ID           string `json:"id"`
+	PolicyID     string `json:"policy_id"`
+	LevelNumber  int    `json:"level_number"`  // 1-based, ordered
+	DelayMinutes int    `json:"delay_minutes"` // Time to wait for ACK before moving on
+	TargetType   string `json:"target_type"`   // user, schedule, team
+	TargetID     string `json:"target_id"`
+	RepeatCount  int    `json:"repeat_count"` // Extra notifications at this level before moving on
+}
+
+type EscalationLevelRequest struct {
+	DelayMinutes int    `json:"delay_minutes" binding:"required,min=1"`
+	TargetType   string `json:"target_type" binding:"required,oneof=user schedule team"`
+	TargetID     string `json:"target_id"`
+	RepeatCount  int    `json:"repeat_count" binding:"min=0"`
+}
+
+type EscalationPolicyRequest struct {
+	Name        string                   `json:"name" binding:"required"`
+	Description string                   `json:"description"`
+	Sources     []string                 `json:"sources"`
+	IsDefault   bool                     `json:"is_default"`
+	Levels      []EscalationLevelRequest `json:"levels" binding:"required,min=1,dive"`
+}
+
+// Escalation target types
+const (
+	EscalationTargetUser     = "user"
+	EscalationTargetSchedule = "schedule"
+	EscalationTargetTeam     = "team"
+)
+
+// Notification Models
+type ContactMethod struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Type       string     `json:"type"`    // push, email, sms, voice
+	Address    string     `json:"address"` // FCM token, email address or phone number
+	IsVerified bool       `json:"is_verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type NotificationRule struct {
+	ID              string    `json:"id"`
+	UserID          string    `json:"user_id"`
+	Channel         string    `json:"channel"`                     // push, email, sms, voice
+	ContactMethodID string    `json:"contact_method_id,omitempty"` // Empty uses the user profile
+	DelayMinutes    int       `json:"delay_minutes"`               // Minutes after the user is paged
+	Severities      []string  `json:"severities"`                  // Empty matches every severity
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type ContactMethodRequest struct {
+	Type    string `json:"type" binding:"required,oneof=push email sms voice"`
+	Address string `json:"address" binding:"required"`
+}
+
+type VerifyContactMethodRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type NotificationRuleRequest struct {
+	Channel         string   `json:"channel" binding:"required,oneof=push email sms voice"`
+	ContactMethodID string   `json:"contact_method_id"`
+	DelayMinutes    int      `json:"delay_minutes" binding:"min=0"`
+	Severities      []string `json:"severities" binding:"dive,oneof=low medium high critical warning info"`
+}
+
+// Notification is one delivery attempt of a page
+type Notification struct {
+	ID               string    `json:"id"`
+	AlertID          string    `json:"alert_id"`
+	UserID           string    `json:"user_id,omitempty"`
+	RuleID           string    `json:"rule_id,omitempty"`
+	Channel          string    `json:"channel"`
+	Target           string    `json:"target"`
+	EscalationLevel  int       `json:"escalation_level"`
+	Attempt          int       `json:"attempt"`
+	Status           string    `json:"status"` // sent, failed, dead, replayed
+	ProviderResponse string    `json:"provider_response,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	LatencyMs        int64     `json:"latency_ms"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Notification delivery statuses
+const (
+	NotificationStatusSent     = "sent"     // Provider accepted the message
+	NotificationStatusFailed   = "failed"   // Attempt failed, a retry is scheduled
+	NotificationStatusDead     = "dead"     // Retries exhausted, waiting in the dead-letter list
+	NotificationStatusReplayed = "replayed" // Dead letter that an admin replayed
+)
+
 // Uptime Monitoring Models
 type Service struct {
 	ID        string    `json:"id"`
@@ -78,6 +745,9 @@ type Service struct {
 
 	// Headers for HTTP requests
 	Headers map[string]string `json:"headers,omitempty"`
+
+	// Escalation policy for alerts raised by this service
+	EscalationPolicyID string `json:"escalation_policy_id,omitempty"`
 }
 
 type ServiceCheck struct {
@@ -230,13 +900,21 @@ type WebhookAlertRequest struct {
 	Description string                 `json:"description" binding:"required"`
 	Severity    string                 `json:"severity" binding:"required,oneof=low medium high critical"`
 	Source      string                 `json:"source" binding:"required"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Labels      map[string]string      `json:"labels,omitempty"` // Matched by label routing rules
+	TeamID      string                 `json:"team_id,omitempty"`
+	DedupKey    string                 `json:"dedup_key,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"` // Stored as the alert's details
+
+	// "resolved" makes the request a resolve event for dedup_key
+	Status string `json:"status,omitempty" binding:"omitempty,oneof=firing resolved"`
 }
 
 type WebhookAlertResponse struct {
 	AlertID    string `json:"alert_id"`
-	Status     string `json:"status"`
+	Status     string `json:"status"` // created, deduplicated, resolved, closed, ignored
 	AssignedTo string `json:"assigned_to,omitempty"`
+	Count      int    `json:"count"`
 	Message    string `json:"message"`
 }
 
@@ -1,72 +1,350 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/vanchonlee/oncallkit/db"
 	"github.com/vanchonlee/oncallkit/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AlertHandler struct {
-	Service *services.AlertService
+	Service      *services.AlertService
+	EventService *services.AlertEventService
 }
 
-func NewAlertHandler(service *services.AlertService) *AlertHandler {
-	return &AlertHandler{Service: service}
+func NewAlertHandler(service *services.AlertService, eventService *services.AlertEventService) *AlertHandler {
+	return &AlertHandler{Service: service, EventService: eventService}
 }
 
+// ListAlerts returns one page of alerts. List parameters take several
+// values, comma separated or repeated; ?tag=a&tag=b lists the alerts
+// carrying both tags.
 func (h *AlertHandler) ListAlerts(c *gin.Context) {
-	alerts, err := h.Service.ListAlerts()
+	filter, err := queryAlertFilter(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Cursor = c.Query("cursor")
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	alerts, err := h.Service.ListAlerts(filter)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
 	c.JSON(http.StatusOK, alerts)
 }
 
-func (h *AlertHandler) CreateAlert(c *gin.Context) {
-	alert, err := h.Service.CreateAlertFromRequest(c)
+// BulkAction applies one action to the alerts listed in the body, or to the
+// alerts matching the ListAlerts query parameters when it lists none
+func (h *AlertHandler) BulkAction(c *gin.Context) {
+	filter, err := queryAlertFilter(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+
+	result, err := h.Service.BulkAction(filter, c.GetString("user_id"), c)
+	if errors.Is(err, services.ErrInvalidBulk) || errors.Is(err, services.ErrInvalidAssignee) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *AlertHandler) CreateAlert(c *gin.Context) {
+	alert, created, err := h.Service.CreateAlertFromRequest(c)
+	if errors.Is(err, services.ErrNoOpenAlert) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Repeated and resolve events change the open alert
+	if !created {
+		c.JSON(http.StatusOK, alert)
+		return
+	}
 	c.JSON(http.StatusCreated, alert)
 }
 
+// GetAlert returns an alert with the alerts merged into it
 func (h *AlertHandler) GetAlert(c *gin.Context) {
 	id := c.Param("id")
-	alert, err := h.Service.GetAlert(id)
-	if err != nil {
+	alert, err := h.Service.GetAlertWithMerged(id)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
 	}
 	c.JSON(http.StatusOK, alert)
 }
 
+// Status changes are attributed to the signed-in user, if any. An action
+// the alert's status does not allow is a 409.
 func (h *AlertHandler) AckAlert(c *gin.Context) {
-	id := c.Param("id")
-	if err := h.Service.AckAlert(id); err != nil {
+	result, err := h.Service.AckAlert(c.Param("id"), c.GetString("user_id"))
+	respondAction(c, result, err)
+}
+
+func (h *AlertHandler) UnackAlert(c *gin.Context) {
+	result, err := h.Service.UnackAlert(c.Param("id"), c.GetString("user_id"))
+	respondAction(c, result, err)
+}
+
+// SnoozeAlert takes {"duration": "2h"} or {"until": "<RFC3339>"}
+func (h *AlertHandler) SnoozeAlert(c *gin.Context) {
+	result, err := h.Service.SnoozeAlert(c.Param("id"), c.GetString("user_id"), c)
+	if errors.Is(err, services.ErrInvalidSnooze) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondAction(c, result, err)
+}
+
+func (h *AlertHandler) ResolveAlert(c *gin.Context) {
+	result, err := h.Service.ResolveAlert(c.Param("id"), c.GetString("user_id"))
+	respondAction(c, result, err)
+}
+
+func (h *AlertHandler) CloseAlert(c *gin.Context) {
+	result, err := h.Service.CloseAlert(c.Param("id"), c.GetString("user_id"))
+	respondAction(c, result, err)
+}
+
+func (h *AlertHandler) ReopenAlert(c *gin.Context) {
+	result, err := h.Service.ReopenAlert(c.Param("id"), c.GetString("user_id"))
+	respondAction(c, result, err)
+}
+
+// AssignAlert hands an alert to a user or a team's on-call, who is paged
+func (h *AlertHandler) AssignAlert(c *gin.Context) {
+	alert, err := h.Service.AssignAlert(c.Param("id"), c.GetString("user_id"), c)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if errors.Is(err, services.ErrInvalidAssignee) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
-	c.Status(http.StatusOK)
+	c.JSON(http.StatusOK, alert)
 }
 
-func (h *AlertHandler) UnackAlert(c *gin.Context) {
-	id := c.Param("id")
-	if err := h.Service.UnackAlert(id); err != nil {
+// EscalateAlert pages the next escalation level without waiting for the
+// current one to time out
+func (h *AlertHandler) EscalateAlert(c *gin.Context) {
+	result, err := h.Service.EscalateNow(c.Param("id"), c.GetString("user_id"))
+	respondAction(c, result, err)
+}
+
+// Merge endpoints take {"alert_ids": [...]}, the alerts to fold into or
+// split out of the alert of the path
+func (h *AlertHandler) MergeAlerts(c *gin.Context) {
+	alert, err := h.Service.MergeAlerts(c.Param("id"), c.GetString("user_id"), c)
+	respondMerge(c, alert, err)
+}
+
+func (h *AlertHandler) UnmergeAlerts(c *gin.Context) {
+	alert, err := h.Service.UnmergeAlerts(c.Param("id"), c.GetString("user_id"), c)
+	respondMerge(c, alert, err)
+}
+
+// Responder endpoints
+func (h *AlertHandler) ListResponders(c *gin.Context) {
+	responders, err := h.Service.ListResponders(c.Param("id"))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
-	c.Status(http.StatusOK)
+	c.JSON(http.StatusOK, responders)
 }
 
-func (h *AlertHandler) CloseAlert(c *gin.Context) {
+func (h *AlertHandler) AddResponders(c *gin.Context) {
+	responders, err := h.Service.AddResponders(c.Param("id"), c.GetString("user_id"), c)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if errors.Is(err, services.ErrInvalidAssignee) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, responders)
+}
+
+// GetTimeline returns everything that happened to an alert, oldest first
+func (h *AlertHandler) GetTimeline(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.Service.CloseAlert(id); err != nil {
+	if _, err := h.Service.GetAlert(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	events, err := h.EventService.ListEvents(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// Tag endpoints
+func (h *AlertHandler) SetTags(c *gin.Context) {
+	tags, err := h.Service.SetTags(c.Param("id"), c.GetString("user_id"), c)
+	h.respondTags(c, tags, err)
+}
+
+func (h *AlertHandler) AddTags(c *gin.Context) {
+	tags, err := h.Service.AddTags(c.Param("id"), c.GetString("user_id"), c)
+	h.respondTags(c, tags, err)
+}
+
+func (h *AlertHandler) RemoveTag(c *gin.Context) {
+	tags, err := h.Service.RemoveTag(c.Param("id"), c.Param("tag"), c.GetString("user_id"))
+	h.respondTags(c, tags, err)
+}
+
+// Detail endpoints
+func (h *AlertHandler) UpdateDetails(c *gin.Context) {
+	details, err := h.Service.UpdateDetails(c.Param("id"), c.GetString("user_id"), c)
+	h.respondDetails(c, details, err)
+}
+
+func (h *AlertHandler) DeleteDetail(c *gin.Context) {
+	details, err := h.Service.MergeDetails(c.Param("id"), c.GetString("user_id"), map[string]interface{}{c.Param("key"): nil})
+	h.respondDetails(c, details, err)
+}
+
+func (h *AlertHandler) respondTags(c *gin.Context, tags []string, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alert_id": c.Param("id"), "tags": tags})
+}
+
+func (h *AlertHandler) respondDetails(c *gin.Context, details map[string]interface{}, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alert_id": c.Param("id"), "details": details})
+}
+
+// queryAlertFilter reads the filters of ListAlerts from the query string
+func queryAlertFilter(c *gin.Context) (services.AlertFilter, error) {
+	filter := services.AlertFilter{
+		Statuses:   queryList(c, "status"),
+		Severities: queryList(c, "severity"),
+		Sources:    queryList(c, "source"),
+		AssignedTo: c.Query("assigned_to"),
+		TeamID:     c.Query("team_id"),
+		Tags:       queryList(c, "tag"),
+		Search:     c.Query("q"),
+	}
+	var err error
+	if filter.From, err = queryTime(c, "from"); err != nil {
+		return filter, err
+	}
+	filter.To, err = queryTime(c, "to")
+	return filter, err
+}
+
+// queryList reads a query parameter given as a comma separated list,
+// repeated, or both
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, v := range c.QueryArray(key) {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+// queryTime reads an optional RFC3339 query parameter
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, errors.New("invalid " + key + ", expected RFC3339")
+	}
+	return &t, nil
+}
+
+func respondMerge(c *gin.Context, alert db.AlertResponse, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if errors.Is(err, services.ErrInvalidMerge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+func respondAction(c *gin.Context, result db.AlertActionResponse, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if errors.Is(err, services.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
-	c.Status(http.StatusOK)
+	c.JSON(http.StatusOK, result)
 }
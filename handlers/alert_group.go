@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type AlertGroupHandler struct {
+	Service *services.AlertGroupService
+}
+
+func NewAlertGroupHandler(service *services.AlertGroupService) *AlertGroupHandler {
+	return &AlertGroupHandler{Service: service}
+}
+
+// Group rule endpoints
+func (h *AlertGroupHandler) ListRules(c *gin.Context) {
+	rules, err := h.Service.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *AlertGroupHandler) GetRule(c *gin.Context) {
+	rule, err := h.Service.GetRule(c.Param("id"))
+	if errors.Is(err, services.ErrAlertGroupRuleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *AlertGroupHandler) CreateRule(c *gin.Context) {
+	rule, err := h.Service.CreateRule(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *AlertGroupHandler) UpdateRule(c *gin.Context) {
+	rule, err := h.Service.UpdateRule(c.Param("id"), c)
+	if errors.Is(err, services.ErrAlertGroupRuleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *AlertGroupHandler) DeleteRule(c *gin.Context) {
+	if err := h.Service.DeleteRule(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert group rule deleted"})
+}
+
+// ListChildren returns the alerts grouped under an alert
+func (h *AlertGroupHandler) ListChildren(c *gin.Context) {
+	children, err := h.Service.ListChildren(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, children)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+// AlertNoteHandler serves the notes of an alert. Writing a note requires a
+// signed-in user, who is recorded as its author.
+type AlertNoteHandler struct {
+	Service *services.AlertNoteService
+}
+
+func NewAlertNoteHandler(service *services.AlertNoteService) *AlertNoteHandler {
+	return &AlertNoteHandler{Service: service}
+}
+
+func (h *AlertNoteHandler) ListNotes(c *gin.Context) {
+	notes, err := h.Service.ListNotes(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+func (h *AlertNoteHandler) CreateNote(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	note, err := h.Service.CreateNote(c.Param("id"), userID.(string), c)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, note)
+}
+
+func (h *AlertNoteHandler) UpdateNote(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	note, err := h.Service.UpdateNote(c.Param("id"), c.Param("noteId"), userID.(string), c)
+	if errors.Is(err, services.ErrNoteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrNoteForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+func (h *AlertNoteHandler) DeleteNote(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	err := h.Service.DeleteNote(c.Param("id"), c.Param("noteId"), userID.(string))
+	if errors.Is(err, services.ErrNoteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrNoteForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "note deleted"})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type AlertPolicyHandler struct {
+	Service *services.AlertPolicyService
+}
+
+func NewAlertPolicyHandler(service *services.AlertPolicyService) *AlertPolicyHandler {
+	return &AlertPolicyHandler{Service: service}
+}
+
+// Alert policy endpoints
+func (h *AlertPolicyHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.Service.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+func (h *AlertPolicyHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.Service.GetPolicy(c.Param("id"))
+	if errors.Is(err, services.ErrAlertPolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+func (h *AlertPolicyHandler) CreatePolicy(c *gin.Context) {
+	policy, err := h.Service.CreatePolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+func (h *AlertPolicyHandler) UpdatePolicy(c *gin.Context) {
+	policy, err := h.Service.UpdatePolicy(c.Param("id"), c)
+	if errors.Is(err, services.ErrAlertPolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+func (h *AlertPolicyHandler) DeletePolicy(c *gin.Context) {
+	if err := h.Service.DeletePolicy(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert policy deleted"})
+}
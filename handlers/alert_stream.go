@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+	"golang.org/x/net/websocket"
+)
+
+// Idle streams get a ping this often so that proxies keep them open
+const streamPingInterval = 30 * time.Second
+
+type AlertStreamHandler struct {
+	Service *services.AlertStreamService
+}
+
+func NewAlertStreamHandler(service *services.AlertStreamService) *AlertStreamHandler {
+	return &AlertStreamHandler{Service: service}
+}
+
+// StreamAlerts pushes alert changes as Server-Sent Events, the event name is
+// the change type. It takes the filters of ListAlerts except q, from and to.
+func (h *AlertStreamHandler) StreamAlerts(c *gin.Context) {
+	events, unsubscribe := h.Service.Subscribe(queryStreamFilter(c))
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+		case <-ping.C:
+			c.SSEvent("ping", gin.H{"time": time.Now()})
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
+// StreamAlertsWebSocket pushes the same changes as StreamAlerts over a
+// WebSocket, one JSON message per change. Messages from the client are
+// ignored.
+func (h *AlertStreamHandler) StreamAlertsWebSocket(c *gin.Context) {
+	filter := queryStreamFilter(c)
+
+	server := websocket.Server{
+		// Clients authenticate with a token, not a cookie, so any origin may connect
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			events, unsubscribe := h.Service.Subscribe(filter)
+			defer unsubscribe()
+
+			// Reading is only how we notice the client has left
+			gone := make(chan struct{})
+			go func() {
+				io.Copy(io.Discard, ws)
+				close(gone)
+			}()
+
+			ping := time.NewTicker(streamPingInterval)
+			defer ping.Stop()
+
+			for {
+				var err error
+				select {
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+					err = websocket.JSON.Send(ws, event)
+				case <-ping.C:
+					err = websocket.JSON.Send(ws, gin.H{"type": "ping", "time": time.Now()})
+				case <-gone:
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// queryStreamFilter reads the filters of the alert stream from the query
+// string, the same parameters as ListAlerts takes
+func queryStreamFilter(c *gin.Context) services.AlertFilter {
+	return services.AlertFilter{
+		Statuses:   queryList(c, "status"),
+		Severities: queryList(c, "severity"),
+		Sources:    queryList(c, "source"),
+		AssignedTo: c.Query("assigned_to"),
+		TeamID:     c.Query("team_id"),
+		Tags:       queryList(c, "tag"),
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,16 +13,18 @@ import (
 )
 
 type APIKeyHandler struct {
-	APIKeyService *services.APIKeyService
-	AlertService  *services.AlertService
-	UserService   *services.UserService
+	APIKeyService      *services.APIKeyService
+	AlertService       *services.AlertService
+	AlertPolicyService *services.AlertPolicyService
+	UserService        *services.UserService
 }
 
-func NewAPIKeyHandler(apiKeyService *services.APIKeyService, alertService *services.AlertService, userService *services.UserService) *APIKeyHandler {
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService, alertService *services.AlertService, alertPolicyService *services.AlertPolicyService, userService *services.UserService) *APIKeyHandler {
 	return &APIKeyHandler{
-		APIKeyService: apiKeyService,
-		AlertService:  alertService,
-		UserService:   userService,
+		APIKeyService:      apiKeyService,
+		AlertService:       alertService,
+		AlertPolicyService: alertPolicyService,
+		UserService:        userService,
 	}
 }
 
@@ -223,6 +226,10 @@ func (h *APIKeyHandler) WebhookAlert(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Status == "resolved" {
+		h.webhookResolve(c, apiKey, req, startTime)
+		return
+	}
 
 	// Create alert
 	alert := &db.Alert{
@@ -230,23 +237,22 @@ func (h *APIKeyHandler) WebhookAlert(c *gin.Context) {
 		Description: req.Description,
 		Severity:    req.Severity,
 		Source:      req.Source,
-		Status:      "open",
-	}
-
-	// Get current on-call user for assignment
-	onCallUser, err := h.UserService.GetCurrentOnCallUser()
-	if err != nil {
-		log.Printf("Warning: Could not get on-call user: %v", err)
-		// Continue without assignment
-	} else {
-		alert.AssignedTo = onCallUser.ID
-		now := time.Now()
-		alert.AssignedAt = &now
-	}
-
-	// Create the alert
-	createdAlert, err := h.AlertService.CreateAlert(alert)
-	if err != nil {
+		Status:      db.AlertStatusNew,
+		TeamID:      req.TeamID,
+		DedupKey:    req.DedupKey,
+		Author:      apiKey.UserID,
+		Tags:        req.Tags,
+		Details:     req.Metadata,
+	}
+
+	// Create the alert, routed to a team by source, labels or this API key
+	// and assigned to that team's on-call
+	createdAlert, err := h.AlertService.CreateRoutedAlert(alert, services.AlertRoute{Labels: req.Labels, APIKeyID: apiKey.ID})
+	if errors.Is(err, services.ErrTeamNotFound) {
+		h.logAPIKeyUsage(apiKey.ID, c, http.StatusBadRequest, time.Since(startTime), "", req.Title, req.Severity, err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		h.logAPIKeyUsage(apiKey.ID, c, http.StatusInternalServerError, time.Since(startTime), "", req.Title, req.Severity, err.Error())
 		log.Printf("Error creating alert: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert"})
@@ -264,12 +270,17 @@ func (h *APIKeyHandler) WebhookAlert(c *gin.Context) {
 	}()
 
 	// Log successful usage
-	h.logAPIKeyUsage(apiKey.ID, c, http.StatusCreated, time.Since(startTime), createdAlert.ID, req.Title, req.Severity, "")
+	status := http.StatusCreated
+	if createdAlert.Count > 1 {
+		status = http.StatusOK
+	}
+	h.logAPIKeyUsage(apiKey.ID, c, status, time.Since(startTime), createdAlert.ID, req.Title, req.Severity, "")
 
 	// Prepare response
 	response := &db.WebhookAlertResponse{
 		AlertID: createdAlert.ID,
 		Status:  "created",
+		Count:   createdAlert.Count,
 		Message: "Alert created successfully",
 	}
 
@@ -277,7 +288,46 @@ func (h *APIKeyHandler) WebhookAlert(c *gin.Context) {
 		response.AssignedTo = createdAlert.AssignedTo
 	}
 
-	c.JSON(http.StatusCreated, response)
+	if createdAlert.Count > 1 {
+		response.Status = "deduplicated"
+		response.Message = "Alert with this dedup_key is still open, count updated"
+	}
+
+	c.JSON(status, response)
+}
+
+// webhookResolve hands a resolve event to the alert policies. Without a
+// matching resolve_event policy the open alert is left as it is.
+func (h *APIKeyHandler) webhookResolve(c *gin.Context, apiKey *db.APIKey, req db.WebhookAlertRequest, startTime time.Time) {
+	alert, applied, err := h.AlertPolicyService.ResolveEvent(req.DedupKey, req.Source)
+	if errors.Is(err, services.ErrMissingDedupKey) {
+		h.logAPIKeyUsage(apiKey.ID, c, http.StatusBadRequest, time.Since(startTime), "", req.Title, req.Severity, err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, services.ErrNoOpenAlert) {
+		h.logAPIKeyUsage(apiKey.ID, c, http.StatusNotFound, time.Since(startTime), "", req.Title, req.Severity, err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		h.logAPIKeyUsage(apiKey.ID, c, http.StatusInternalServerError, time.Since(startTime), "", req.Title, req.Severity, err.Error())
+		log.Printf("Error resolving alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve alert"})
+		return
+	}
+	h.logAPIKeyUsage(apiKey.ID, c, http.StatusOK, time.Since(startTime), alert.ID, req.Title, req.Severity, "")
+
+	response := &db.WebhookAlertResponse{
+		AlertID:    alert.ID,
+		Status:     alert.Status,
+		AssignedTo: alert.AssignedTo,
+		Count:      alert.Count,
+		Message:    "Alert " + alert.Status + " by its alert policy",
+	}
+	if !applied {
+		response.Status = "ignored"
+		response.Message = "No resolve_event policy matches this alert, it stays open"
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // API Key Authentication Middleware
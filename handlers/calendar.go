@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type CalendarHandler struct {
+	Service *services.CalendarService
+}
+
+func NewCalendarHandler(service *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{Service: service}
+}
+
+// RotationCalendar serves the ICS feed of a rotation
+func (h *CalendarHandler) RotationCalendar(c *gin.Context) {
+	feed, err := h.Service.RotationCalendar(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeCalendar(c, "oncall.ics", feed)
+}
+
+// UserCalendar serves the ICS feed of every shift of one user
+func (h *CalendarHandler) UserCalendar(c *gin.Context) {
+	feed, err := h.Service.UserCalendar(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeCalendar(c, "my-oncall.ics", feed)
+}
+
+// ImportCalendar creates schedule rows from an uploaded ICS file
+func (h *CalendarHandler) ImportCalendar(c *gin.Context) {
+	result, err := h.Service.ImportCalendar(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func writeCalendar(c *gin.Context, filename string, feed []byte) {
+	c.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", feed)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type CoverageHandler struct {
+	Service *services.CoverageService
+}
+
+func NewCoverageHandler(service *services.CoverageService) *CoverageHandler {
+	return &CoverageHandler{Service: service}
+}
+
+// GetCoverage reports coverage gaps and overlapping shifts, defaulting to
+// the next 7 days. ?rotation_id= limits the check to one rotation and
+// ?team_id= to the schedules of one team.
+func (h *CoverageHandler) GetCoverage(c *gin.Context) {
+	from, to, err := parseTimeRange(c, 7*24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.Service.Coverage(from, to, c.Query("rotation_id"), c.Query("team_id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rotation not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type EscalationHandler struct {
+	Service *services.EscalationService
+}
+
+func NewEscalationHandler(service *services.EscalationService) *EscalationHandler {
+	return &EscalationHandler{Service: service}
+}
+
+// Escalation policy endpoints
+func (h *EscalationHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.Service.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+func (h *EscalationHandler) GetPolicy(c *gin.Context) {
+	id := c.Param("id")
+	policy, err := h.Service.GetPolicy(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "escalation policy not found"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+func (h *EscalationHandler) CreatePolicy(c *gin.Context) {
+	policy, err := h.Service.CreatePolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+func (h *EscalationHandler) UpdatePolicy(c *gin.Context) {
+	id := c.Param("id")
+	policy, err := h.Service.UpdatePolicy(id, c)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "escalation policy not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+func (h *EscalationHandler) DeletePolicy(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.Service.DeletePolicy(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "escalation policy deleted"})
+}
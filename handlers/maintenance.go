@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type MaintenanceHandler struct {
+	Service *services.MaintenanceService
+}
+
+func NewMaintenanceHandler(service *services.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{Service: service}
+}
+
+// Maintenance window endpoints
+func (h *MaintenanceHandler) ListWindows(c *gin.Context) {
+	windows, err := h.Service.ListWindows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, windows)
+}
+
+func (h *MaintenanceHandler) GetWindow(c *gin.Context) {
+	window, err := h.Service.GetWindow(c.Param("id"))
+	if errors.Is(err, services.ErrMaintenanceWindowNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, window)
+}
+
+func (h *MaintenanceHandler) CreateWindow(c *gin.Context) {
+	window, err := h.Service.CreateWindow(c.GetString("user_id"), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, window)
+}
+
+func (h *MaintenanceHandler) UpdateWindow(c *gin.Context) {
+	window, err := h.Service.UpdateWindow(c.Param("id"), c)
+	if errors.Is(err, services.ErrMaintenanceWindowNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, window)
+}
+
+func (h *MaintenanceHandler) DeleteWindow(c *gin.Context) {
+	if err := h.Service.DeleteWindow(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "maintenance window deleted"})
+}
@@ -61,6 +61,19 @@ func (m *AuthMiddleware) JWTAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// StreamAuthMiddleware works like JWTAuthMiddleware but also takes the token
+// from the access_token query parameter. Browsers cannot set headers on
+// EventSource and WebSocket connections.
+func (m *AuthMiddleware) StreamAuthMiddleware() gin.HandlerFunc {
+	jwtAuth := m.JWTAuthMiddleware()
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		jwtAuth(c)
+	}
+}
+
 // AdminOnlyMiddleware ensures only admin users can access
 func (m *AuthMiddleware) AdminOnlyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type NotificationHandler struct {
+	Service *services.NotificationService
+}
+
+func NewNotificationHandler(service *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{Service: service}
+}
+
+// ListAlertNotifications returns the delivery history of an alert
+func (h *NotificationHandler) ListAlertNotifications(c *gin.Context) {
+	notifications, err := h.Service.ListAlertNotifications(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// Dead-letter endpoints
+func (h *NotificationHandler) ListDeadLetters(c *gin.Context) {
+	notifications, err := h.Service.ListDeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+func (h *NotificationHandler) ReplayDeadLetter(c *gin.Context) {
+	notification, err := h.Service.ReplayDeadLetter(c.Param("id"), c.GetString("user_id"))
+	if err == services.ErrDeadLetterNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, notification)
+}
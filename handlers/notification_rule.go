@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/db"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type NotificationRuleHandler struct {
+	Service *services.NotificationRuleService
+}
+
+func NewNotificationRuleHandler(service *services.NotificationRuleService) *NotificationRuleHandler {
+	return &NotificationRuleHandler{Service: service}
+}
+
+// Notification rule endpoints
+func (h *NotificationRuleHandler) ListRules(c *gin.Context) {
+	rules, err := h.Service.ListRules(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *NotificationRuleHandler) CreateRule(c *gin.Context) {
+	rule, err := h.Service.CreateRule(c.Param("id"), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *NotificationRuleHandler) UpdateRule(c *gin.Context) {
+	rule, err := h.Service.UpdateRule(c.Param("id"), c.Param("ruleId"), c)
+	if err == services.ErrRuleNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *NotificationRuleHandler) DeleteRule(c *gin.Context) {
+	err := h.Service.DeleteRule(c.Param("id"), c.Param("ruleId"))
+	if err == services.ErrRuleNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "notification rule deleted"})
+}
+
+// Contact method endpoints
+func (h *NotificationRuleHandler) ListContactMethods(c *gin.Context) {
+	methods, err := h.Service.ListContactMethods(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, methods)
+}
+
+func (h *NotificationRuleHandler) CreateContactMethod(c *gin.Context) {
+	method, err := h.Service.CreateContactMethod(c.Param("id"), c)
+	if err != nil && method.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		// Stored, but the code did not go out; the client can resend it
+		c.JSON(http.StatusCreated, gin.H{"contact_method": method, "warning": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"contact_method": method})
+}
+
+func (h *NotificationRuleHandler) SendVerification(c *gin.Context) {
+	err := h.Service.SendVerification(c.Param("id"), c.Param("methodId"))
+	if err == services.ErrContactMethodNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "verification code sent"})
+}
+
+func (h *NotificationRuleHandler) VerifyContactMethod(c *gin.Context) {
+	var req db.VerifyContactMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	method, err := h.Service.VerifyContactMethod(c.Param("id"), c.Param("methodId"), req.Code)
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, method)
+	case services.ErrContactMethodNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case services.ErrInvalidVerification:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+	}
+}
+
+func (h *NotificationRuleHandler) DeleteContactMethod(c *gin.Context) {
+	err := h.Service.DeleteContactMethod(c.Param("id"), c.Param("methodId"))
+	if err == services.ErrContactMethodNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "contact method deleted"})
+}
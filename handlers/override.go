@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/db"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+// OverrideHandler serves overrides and shift swaps. Every change is recorded
+// with the authenticated user that made it.
+type OverrideHandler struct {
+	Service *services.OverrideService
+}
+
+func NewOverrideHandler(service *services.OverrideService) *OverrideHandler {
+	return &OverrideHandler{Service: service}
+}
+
+// Override endpoints
+
+// ListOverrides returns active overrides, defaulting to the next 30 days
+func (h *OverrideHandler) ListOverrides(c *gin.Context) {
+	from, to, err := parseTimeRange(c, 30*24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	overrides, err := h.Service.ListOverrides(c.Param("id"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, overrides)
+}
+
+func (h *OverrideHandler) CreateOverride(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	override, err := h.Service.CreateOverride(c.Param("id"), userID.(string), c)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rotation not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, override)
+}
+
+func (h *OverrideHandler) CancelOverride(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	err := h.Service.CancelOverride(c.Param("id"), c.Param("overrideId"), userID.(string))
+	if err == services.ErrOverrideNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "override cancelled"})
+}
+
+// Shift swap endpoints
+
+// ListSwaps returns the swaps the authenticated user proposed or received
+func (h *OverrideHandler) ListSwaps(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	swaps, err := h.Service.ListSwaps(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, swaps)
+}
+
+func (h *OverrideHandler) ProposeSwap(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	swap, err := h.Service.ProposeSwap(userID.(string), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, swap)
+}
+
+func (h *OverrideHandler) AcceptSwap(c *gin.Context) {
+	h.answerSwap(c, h.Service.AcceptSwap)
+}
+
+func (h *OverrideHandler) DeclineSwap(c *gin.Context) {
+	h.answerSwap(c, h.Service.DeclineSwap)
+}
+
+func (h *OverrideHandler) CancelSwap(c *gin.Context) {
+	h.answerSwap(c, h.Service.CancelSwap)
+}
+
+func (h *OverrideHandler) answerSwap(c *gin.Context, answer func(id, actorID string) (db.ShiftSwap, error)) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	swap, err := answer(c.Param("id"), userID.(string))
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, swap)
+	case services.ErrSwapNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case services.ErrSwapForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case services.ErrSwapNotPending:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type RotationHandler struct {
+	Service     *services.RotationService
+	UserService *services.UserService
+}
+
+func NewRotationHandler(service *services.RotationService, userService *services.UserService) *RotationHandler {
+	return &RotationHandler{Service: service, UserService: userService}
+}
+
+// Rotation endpoints
+func (h *RotationHandler) ListRotations(c *gin.Context) {
+	rotations, err := h.Service.ListRotations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, rotations)
+}
+
+func (h *RotationHandler) GetRotation(c *gin.Context) {
+	rotation, err := h.Service.GetRotation(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rotation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rotation)
+}
+
+func (h *RotationHandler) CreateRotation(c *gin.Context) {
+	rotation, err := h.Service.CreateRotation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rotation)
+}
+
+func (h *RotationHandler) UpdateRotation(c *gin.Context) {
+	rotation, err := h.Service.UpdateRotation(c.Param("id"), c)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rotation not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rotation)
+}
+
+func (h *RotationHandler) DeleteRotation(c *gin.Context) {
+	if err := h.Service.DeleteRotation(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "rotation deleted"})
+}
+
+// GetCurrentOnCall returns the user on call for a rotation right now
+func (h *RotationHandler) GetCurrentOnCall(c *gin.Context) {
+	user, err := h.UserService.GetRotationOnCallUser(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no on-call user found"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// ListShifts expands a rotation into shifts, defaulting to the next 7 days.
+// from and to are RFC 3339 timestamps; shifts come back in UTC along with
+// the rotation time zone.
+func (h *RotationHandler) ListShifts(c *gin.Context) {
+	from, to, err := parseTimeRange(c, 7*24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rotation, err := h.Service.GetRotation(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rotation not found"})
+		return
+	}
+
+	shifts, err := h.Service.Shifts(rotation.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from.UTC(), "to": to.UTC(), "time_zone": rotation.TimeZone, "shifts": shifts})
+}
+
+// parseTimeRange reads the from/to query parameters, starting now and
+// spanning window when they are missing
+func parseTimeRange(c *gin.Context, window time.Duration) (time.Time, time.Time, error) {
+	from := time.Now().UTC()
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, from, err
+		}
+		from = t
+	}
+
+	to := from.Add(window)
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, err
+		}
+		to = t
+	}
+	return from, to, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+type TeamHandler struct {
+	Service     *services.TeamService
+	UserService *services.UserService
+}
+
+func NewTeamHandler(service *services.TeamService, userService *services.UserService) *TeamHandler {
+	return &TeamHandler{Service: service, UserService: userService}
+}
+
+// Team endpoints
+func (h *TeamHandler) ListTeams(c *gin.Context) {
+	teams, err := h.Service.ListTeams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, teams)
+}
+
+func (h *TeamHandler) GetTeam(c *gin.Context) {
+	team, err := h.Service.GetTeam(c.Param("id"))
+	if errors.Is(err, services.ErrTeamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	team, err := h.Service.CreateTeam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, team)
+}
+
+func (h *TeamHandler) UpdateTeam(c *gin.Context) {
+	team, err := h.Service.UpdateTeam(c.Param("id"), c)
+	if errors.Is(err, services.ErrTeamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+func (h *TeamHandler) DeleteTeam(c *gin.Context) {
+	if err := h.Service.DeleteTeam(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "team deleted"})
+}
+
+// GetCurrentOnCall returns the user on call for a team right now
+func (h *TeamHandler) GetCurrentOnCall(c *gin.Context) {
+	user, err := h.UserService.GetTeamOnCallUser(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no on-call user found"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// Routing rule endpoints
+func (h *TeamHandler) ListRoutingRules(c *gin.Context) {
+	rules, err := h.Service.ListRoutingRules(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *TeamHandler) CreateRoutingRule(c *gin.Context) {
+	rule, err := h.Service.CreateRoutingRule(c.Param("id"), c)
+	if errors.Is(err, services.ErrTeamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *TeamHandler) DeleteRoutingRule(c *gin.Context) {
+	err := h.Service.DeleteRoutingRule(c.Param("id"), c.Param("ruleId"))
+	if errors.Is(err, services.ErrRoutingRuleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "routing rule deleted"})
+}
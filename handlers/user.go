@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/db"
 	"github.com/vanchonlee/oncallkit/services"
 )
 
@@ -65,8 +67,16 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 }
 
 // On-call endpoints
+// GetCurrentOnCallUser returns the default on-call, or with ?team_id= the
+// on-call of one team
 func (h *UserHandler) GetCurrentOnCallUser(c *gin.Context) {
-	user, err := h.Service.GetCurrentOnCallUser()
+	var user db.User
+	var err error
+	if teamID := c.Query("team_id"); teamID != "" {
+		user, err = h.Service.GetTeamOnCallUser(teamID)
+	} else {
+		user, err = h.Service.GetCurrentOnCallUser()
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "no on-call user found"})
 		return
@@ -76,7 +86,10 @@ func (h *UserHandler) GetCurrentOnCallUser(c *gin.Context) {
 
 func (h *UserHandler) CreateOnCallSchedule(c *gin.Context) {
 	schedule, err := h.Service.CreateOnCallSchedule(c)
-	if err != nil {
+	if errors.Is(err, services.ErrScheduleOverlap) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,47 @@
+-- Migration: Multi-level escalation policies
+-- Created: 2026-10-16
+
+-- Escalation policies - attached to alerts by source or by uptime service
+CREATE TABLE IF NOT EXISTS escalation_policies (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    sources TEXT[] DEFAULT '{}', -- Alert sources this policy applies to
+    is_default BOOLEAN NOT NULL DEFAULT false, -- Fallback when nothing else matches
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Escalation levels - ordered steps of a policy
+CREATE TABLE IF NOT EXISTS escalation_levels (
+    id VARCHAR(36) PRIMARY KEY,
+    policy_id VARCHAR(36) NOT NULL REFERENCES escalation_policies(id) ON DELETE CASCADE,
+    level_number INTEGER NOT NULL, -- 1-based
+    delay_minutes INTEGER NOT NULL DEFAULT 5, -- Time to wait for ACK before moving on
+    target_type VARCHAR(20) NOT NULL, -- user, schedule, team
+    target_id TEXT NOT NULL DEFAULT '',
+    repeat_count INTEGER NOT NULL DEFAULT 0, -- Extra notifications at this level
+
+    UNIQUE(policy_id, level_number),
+    CONSTRAINT valid_target_type CHECK (target_type IN ('user', 'schedule', 'team'))
+);
+
+-- Attach policies to uptime services
+ALTER TABLE services ADD COLUMN IF NOT EXISTS escalation_policy_id VARCHAR(36) REFERENCES escalation_policies(id) ON DELETE SET NULL;
+
+-- Track escalation progress on alerts
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalation_policy_id VARCHAR(36) REFERENCES escalation_policies(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalation_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP;
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_escalation_levels_policy_id ON escalation_levels(policy_id);
+CREATE INDEX IF NOT EXISTS idx_escalation_policies_sources ON escalation_policies USING GIN (sources);
+CREATE INDEX IF NOT EXISTS idx_alerts_escalation_policy_id ON alerts(escalation_policy_id);
+
+-- ROLLBACK:
+-- ALTER TABLE alerts DROP COLUMN escalated_at, DROP COLUMN escalation_level, DROP COLUMN escalation_policy_id;
+-- ALTER TABLE services DROP COLUMN escalation_policy_id;
+-- DROP TABLE escalation_levels;
+-- DROP TABLE escalation_policies;
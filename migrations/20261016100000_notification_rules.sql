@@ -0,0 +1,40 @@
+-- Migration: Per-user contact methods and notification rules
+-- Created: 2026-10-16
+
+-- Contact methods - addresses a user can be paged on, verified before use
+CREATE TABLE IF NOT EXISTS user_contact_methods (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL, -- push, email, sms, voice
+    address TEXT NOT NULL, -- FCM token, email address or phone number
+    is_verified BOOLEAN NOT NULL DEFAULT false,
+    verified_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    UNIQUE(user_id, type, address),
+    CONSTRAINT valid_contact_type CHECK (type IN ('push', 'email', 'sms', 'voice'))
+);
+
+-- Notification rules - "push immediately for critical, SMS after 2 minutes"
+CREATE TABLE IF NOT EXISTS user_notification_rules (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL, -- push, email, sms, voice
+    contact_method_id VARCHAR(36) REFERENCES user_contact_methods(id) ON DELETE CASCADE, -- NULL uses the user profile
+    delay_minutes INTEGER NOT NULL DEFAULT 0, -- Minutes after the user is paged
+    severities TEXT[] DEFAULT '{}', -- Empty matches every severity
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_rule_channel CHECK (channel IN ('push', 'email', 'sms', 'voice')),
+    CONSTRAINT valid_rule_delay CHECK (delay_minutes >= 0)
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_contact_methods_user_id ON user_contact_methods(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_notification_rules_user_id ON user_notification_rules(user_id);
+
+-- ROLLBACK:
+-- DROP TABLE user_notification_rules;
+-- DROP TABLE user_contact_methods;
@@ -0,0 +1,28 @@
+-- Migration: Notification delivery log
+-- Created: 2026-10-16
+
+-- Notifications - one row per delivery attempt
+CREATE TABLE IF NOT EXISTS notifications (
+    id VARCHAR(36) PRIMARY KEY,
+    alert_id TEXT NOT NULL, -- No FK: uptime and AlertManager pages can outlive their alert rows
+    user_id TEXT, -- NULL for shared webhook and chat channels
+    rule_id VARCHAR(36), -- Notification rule that produced the page, if any
+    channel VARCHAR(20) NOT NULL,
+    target TEXT NOT NULL DEFAULT '', -- Email, phone number, URL or masked device token
+    escalation_level INTEGER NOT NULL DEFAULT 0,
+    attempt INTEGER NOT NULL DEFAULT 1, -- 1-based, retries increase it
+    status VARCHAR(20) NOT NULL, -- sent, failed, dead, replayed
+    provider_response TEXT DEFAULT '',
+    error TEXT DEFAULT '',
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_notification_status CHECK (status IN ('sent', 'failed', 'dead', 'replayed'))
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_notifications_alert_id ON notifications(alert_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_dead ON notifications(created_at) WHERE status = 'dead';
+
+-- ROLLBACK:
+-- DROP TABLE notifications;
@@ -0,0 +1,36 @@
+-- Migration: Recurring on-call rotations with layers
+-- Created: 2026-10-16
+
+-- Rotations - recurring on-call schedule definitions
+CREATE TABLE IF NOT EXISTS rotations (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- IANA zone used for handoff times
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Rotation layers - the highest layer with someone on call wins
+CREATE TABLE IF NOT EXISTS rotation_layers (
+    id VARCHAR(36) PRIMARY KEY,
+    rotation_id VARCHAR(36) NOT NULL REFERENCES rotations(id) ON DELETE CASCADE,
+    layer_number INTEGER NOT NULL, -- 1-based, higher wins
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    participants TEXT[] NOT NULL, -- Ordered user IDs
+    shift_type VARCHAR(20) NOT NULL, -- daily, weekly, custom
+    shift_length_hours INTEGER NOT NULL DEFAULT 0, -- Only for custom shifts
+    handoff_time VARCHAR(5) NOT NULL DEFAULT '09:00', -- HH:MM local time
+    start_date DATE NOT NULL, -- First handoff, local date
+
+    UNIQUE(rotation_id, layer_number),
+    CONSTRAINT valid_shift_type CHECK (shift_type IN ('daily', 'weekly', 'custom'))
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_rotation_layers_rotation_id ON rotation_layers(rotation_id);
+
+-- ROLLBACK:
+-- DROP TABLE rotation_layers;
+-- DROP TABLE rotations;
@@ -0,0 +1,48 @@
+-- Migration: Schedule overrides and shift swaps
+-- Created: 2026-10-16
+
+-- Shift swap requests - proposed by one engineer, accepted by the other
+CREATE TABLE IF NOT EXISTS shift_swaps (
+    id VARCHAR(36) PRIMARY KEY,
+    rotation_id VARCHAR(36) NOT NULL REFERENCES rotations(id) ON DELETE CASCADE,
+    requester_id TEXT NOT NULL REFERENCES users(id),
+    target_user_id TEXT NOT NULL REFERENCES users(id),
+    start_time TIMESTAMPTZ NOT NULL, -- Requester's time the target takes over
+    end_time TIMESTAMPTZ NOT NULL,
+    swap_start_time TIMESTAMPTZ, -- Optional target's time the requester takes in return
+    swap_end_time TIMESTAMPTZ,
+    reason TEXT DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, accepted, declined, cancelled
+    responded_by TEXT REFERENCES users(id),
+    responded_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_swap_status CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    CONSTRAINT valid_swap_range CHECK (end_time > start_time)
+);
+
+-- Schedule overrides - put a user on top of a rotation for a time range
+CREATE TABLE IF NOT EXISTS schedule_overrides (
+    id VARCHAR(36) PRIMARY KEY,
+    rotation_id VARCHAR(36) NOT NULL REFERENCES rotations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    reason TEXT DEFAULT '',
+    swap_id VARCHAR(36) REFERENCES shift_swaps(id) ON DELETE SET NULL, -- Set when created by an accepted swap
+    created_by TEXT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    cancelled_by TEXT REFERENCES users(id),
+    cancelled_at TIMESTAMPTZ,
+
+    CONSTRAINT valid_override_range CHECK (end_time > start_time)
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_schedule_overrides_rotation_time ON schedule_overrides(rotation_id, start_time, end_time) WHERE cancelled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_shift_swaps_requester_id ON shift_swaps(requester_id);
+CREATE INDEX IF NOT EXISTS idx_shift_swaps_target_user_id ON shift_swaps(target_user_id);
+
+-- ROLLBACK:
+-- DROP TABLE schedule_overrides;
+-- DROP TABLE shift_swaps;
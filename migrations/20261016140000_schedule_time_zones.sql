@@ -0,0 +1,18 @@
+-- Migration: Time zone aware on-call schedules
+-- Created: 2026-10-16
+
+-- Schedules were stored as naive timestamps written in the server's zone.
+-- Existing rows are interpreted as UTC; run the ALTER with a different
+-- AT TIME ZONE if the API server ran in another zone.
+ALTER TABLE on_call_schedules
+    ALTER COLUMN start_time TYPE TIMESTAMPTZ USING start_time AT TIME ZONE 'UTC',
+    ALTER COLUMN end_time TYPE TIMESTAMPTZ USING end_time AT TIME ZONE 'UTC';
+
+-- IANA zone the shift was planned in, returned alongside the UTC times
+ALTER TABLE on_call_schedules ADD COLUMN IF NOT EXISTS time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- ROLLBACK:
+-- ALTER TABLE on_call_schedules DROP COLUMN time_zone;
+-- ALTER TABLE on_call_schedules
+--     ALTER COLUMN start_time TYPE TIMESTAMP USING start_time AT TIME ZONE 'UTC',
+--     ALTER COLUMN end_time TYPE TIMESTAMP USING end_time AT TIME ZONE 'UTC';
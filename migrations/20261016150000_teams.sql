@@ -0,0 +1,50 @@
+-- Migration: Teams with their own schedules and alert routing
+-- Created: 2026-10-16
+
+-- Teams - members are the users whose team column holds the team name
+CREATE TABLE IF NOT EXISTS teams (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT DEFAULT '',
+    escalation_policy_id VARCHAR(36) REFERENCES escalation_policies(id) ON DELETE SET NULL, -- Used for the team's alerts
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Every team already named on a user becomes a team
+INSERT INTO teams (id, name)
+SELECT md5(random()::text || team)::uuid::text, team
+FROM (SELECT DISTINCT team FROM users WHERE team IS NOT NULL AND team <> '') existing
+ON CONFLICT (name) DO NOTHING;
+
+-- Routing rules - the first matching rule, lowest priority first, picks the team of a new alert
+CREATE TABLE IF NOT EXISTS team_routing_rules (
+    id VARCHAR(36) PRIMARY KEY,
+    team_id VARCHAR(36) NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    match_type VARCHAR(20) NOT NULL, -- source, label, api_key
+    match_key VARCHAR(255) NOT NULL DEFAULT '', -- Label name, only for label rules
+    match_value VARCHAR(255) NOT NULL, -- Source, label value or API key ID
+    priority INTEGER NOT NULL DEFAULT 100,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_match_type CHECK (match_type IN ('source', 'label', 'api_key'))
+);
+
+-- Team owned schedules and routed alerts
+ALTER TABLE rotations ADD COLUMN IF NOT EXISTS team_id VARCHAR(36) REFERENCES teams(id) ON DELETE SET NULL;
+ALTER TABLE on_call_schedules ADD COLUMN IF NOT EXISTS team_id VARCHAR(36) REFERENCES teams(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS team_id VARCHAR(36) REFERENCES teams(id) ON DELETE SET NULL;
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_team_routing_rules_team_id ON team_routing_rules(team_id);
+CREATE INDEX IF NOT EXISTS idx_rotations_team_id ON rotations(team_id);
+CREATE INDEX IF NOT EXISTS idx_on_call_schedules_team_id ON on_call_schedules(team_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_team_id ON alerts(team_id);
+
+-- ROLLBACK:
+-- ALTER TABLE alerts DROP COLUMN team_id;
+-- ALTER TABLE on_call_schedules DROP COLUMN team_id;
+-- ALTER TABLE rotations DROP COLUMN team_id;
+-- DROP TABLE team_routing_rules;
+-- DROP TABLE teams;
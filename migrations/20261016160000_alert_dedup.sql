@@ -0,0 +1,20 @@
+-- Migration: Alert deduplication by dedup key
+-- Created: 2026-10-16
+
+-- Events with the dedup_key of an alert that is not closed yet increment its count
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS dedup_key TEXT;
+
+UPDATE alerts SET count = 1 WHERE count IS NULL;
+ALTER TABLE alerts ALTER COLUMN count SET DEFAULT 1;
+ALTER TABLE alerts ALTER COLUMN count SET NOT NULL;
+
+-- AlertManager alerts used their fingerprint as ID
+UPDATE alerts SET dedup_key = id WHERE source = 'alertmanager' AND dedup_key IS NULL;
+
+-- At most one open alert per dedup key
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open_dedup_key ON alerts(dedup_key) WHERE status <> 'closed';
+
+-- ROLLBACK:
+-- DROP INDEX idx_alerts_open_dedup_key;
+-- ALTER TABLE alerts ALTER COLUMN count DROP NOT NULL, ALTER COLUMN count DROP DEFAULT;
+-- ALTER TABLE alerts DROP COLUMN dedup_key;
@@ -0,0 +1,21 @@
+-- Migration: Alert timeline
+-- Created: 2026-10-16
+
+-- Alert events - append-only history of everything that happened to an alert
+CREATE TABLE IF NOT EXISTS alert_events (
+    id VARCHAR(36) PRIMARY KEY,
+    alert_id TEXT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL, -- created, acked, escalated, notification_sent, ...
+    actor_type VARCHAR(20) NOT NULL DEFAULT 'system', -- user, api_key, system
+    actor_id TEXT, -- User or API key ID
+    old_value TEXT,
+    new_value TEXT,
+    message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_alert_events_alert_id ON alert_events(alert_id, created_at);
+
+-- ROLLBACK:
+-- DROP TABLE alert_events;
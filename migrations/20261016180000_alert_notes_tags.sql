@@ -0,0 +1,25 @@
+-- Migration: Alert notes, tags and details
+-- Created: 2026-10-16
+
+-- Alert notes - free text left by responders
+CREATE TABLE IF NOT EXISTS alert_notes (
+    id VARCHAR(36) PRIMARY KEY,
+    alert_id TEXT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    author_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Free-form tags and key/value details (webhook metadata ends up here)
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS details JSONB NOT NULL DEFAULT '{}';
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_alert_notes_alert_id ON alert_notes(alert_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_alerts_tags ON alerts USING GIN (tags);
+
+-- ROLLBACK:
+-- ALTER TABLE alerts DROP COLUMN details;
+-- ALTER TABLE alerts DROP COLUMN tags;
+-- DROP TABLE alert_notes;
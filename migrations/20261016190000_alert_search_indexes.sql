@@ -0,0 +1,19 @@
+-- Migration: Indexes for alert filtering, search and cursor pagination
+-- Created: 2026-10-16
+
+-- Cursor pagination walks alerts newest first, ties broken by ID
+CREATE INDEX IF NOT EXISTS idx_alerts_created_at_id ON alerts(created_at DESC, id DESC);
+
+-- Filters (status, assigned_to and team_id are indexed already)
+CREATE INDEX IF NOT EXISTS idx_alerts_severity ON alerts(severity);
+CREATE INDEX IF NOT EXISTS idx_alerts_source ON alerts(source);
+
+-- Full-text search over title and description, must match the expression in AlertService.ListAlerts
+CREATE INDEX IF NOT EXISTS idx_alerts_search ON alerts
+    USING GIN (to_tsvector('simple', title || ' ' || COALESCE(description, '')));
+
+-- ROLLBACK:
+-- DROP INDEX idx_alerts_search;
+-- DROP INDEX idx_alerts_source;
+-- DROP INDEX idx_alerts_severity;
+-- DROP INDEX idx_alerts_created_at_id;
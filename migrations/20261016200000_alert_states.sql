@@ -0,0 +1,26 @@
+-- Migration: Alert state machine with resolved state and actor attribution
+-- Created: 2026-10-16
+
+-- "open" was used by the webhook and uptime checks for what is "new" everywhere else
+UPDATE alerts SET status = 'new' WHERE status = 'open';
+
+-- Only the states of the state machine, existing rows are not re-checked
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS valid_alert_status;
+ALTER TABLE alerts ADD CONSTRAINT valid_alert_status
+    CHECK (status IN ('new', 'acked', 'escalated', 'resolved', 'closed')) NOT VALID;
+
+-- Who resolved or closed the alert, acked_by already exists
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS resolved_by TEXT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS closed_by TEXT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+
+-- A resolved alert no longer takes repeated events, the next one opens a new alert
+DROP INDEX IF EXISTS idx_alerts_open_dedup_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open_dedup_key ON alerts(dedup_key) WHERE status NOT IN ('resolved', 'closed');
+
+-- ROLLBACK:
+-- DROP INDEX idx_alerts_open_dedup_key;
+-- CREATE UNIQUE INDEX idx_alerts_open_dedup_key ON alerts(dedup_key) WHERE status <> 'closed';
+-- ALTER TABLE alerts DROP COLUMN closed_at, DROP COLUMN closed_by, DROP COLUMN resolved_at, DROP COLUMN resolved_by;
+-- ALTER TABLE alerts DROP CONSTRAINT valid_alert_status;
@@ -0,0 +1,14 @@
+-- Migration: Snoozed alerts
+-- Created: 2026-10-16
+
+-- A snoozed alert stops paging until snoozed_until, then it is reopened
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMP;
+
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS valid_alert_status;
+ALTER TABLE alerts ADD CONSTRAINT valid_alert_status
+    CHECK (status IN ('new', 'acked', 'escalated', 'snoozed', 'resolved', 'closed')) NOT VALID;
+
+-- ROLLBACK:
+-- ALTER TABLE alerts DROP CONSTRAINT valid_alert_status;
+-- ALTER TABLE alerts ADD CONSTRAINT valid_alert_status CHECK (status IN ('new', 'acked', 'escalated', 'resolved', 'closed')) NOT VALID;
+-- ALTER TABLE alerts DROP COLUMN snoozed_until;
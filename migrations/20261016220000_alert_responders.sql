@@ -0,0 +1,15 @@
+-- Migration: Additional responders paged on an alert
+-- Created: 2026-10-16
+
+-- Alert responders - people paged on top of the assignee and escalation levels
+CREATE TABLE IF NOT EXISTS alert_responders (
+    alert_id TEXT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    added_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (alert_id, user_id)
+);
+
+-- ROLLBACK:
+-- DROP TABLE alert_responders;
@@ -0,0 +1,26 @@
+-- Migration: Auto-resolve and auto-close policies
+-- Created: 2026-10-16
+
+-- Alert policies - resolve or close alerts of a source and/or severity without a human
+CREATE TABLE IF NOT EXISTS alert_policies (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    source VARCHAR(255) NOT NULL DEFAULT '', -- Empty matches every source
+    severity VARCHAR(50) NOT NULL DEFAULT '', -- Empty matches every severity
+    trigger VARCHAR(20) NOT NULL, -- stale, resolve_event
+    action VARCHAR(20) NOT NULL, -- resolve, close
+    stale_minutes INTEGER NOT NULL DEFAULT 0, -- Minutes without an update, stale policies only
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_alert_policy_trigger CHECK (trigger IN ('stale', 'resolve_event')),
+    CONSTRAINT valid_alert_policy_action CHECK (action IN ('resolve', 'close'))
+);
+
+-- Stale policies look for open alerts by last update
+CREATE INDEX IF NOT EXISTS idx_alerts_status_updated_at ON alerts(status, updated_at);
+
+-- ROLLBACK:
+-- DROP INDEX idx_alerts_status_updated_at;
+-- DROP TABLE alert_policies;
@@ -0,0 +1,32 @@
+-- Migration: Alert grouping
+-- Created: 2026-10-16
+
+-- Grouping rules - attach new alerts sharing a key to the open parent alert of that key
+CREATE TABLE IF NOT EXISTS alert_group_rules (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    source VARCHAR(255) NOT NULL DEFAULT '', -- Empty matches every source
+    group_by VARCHAR(30) NOT NULL, -- label, service, source, alertmanager_group, time
+    label VARCHAR(255) NOT NULL DEFAULT '', -- Label key, group_by label only
+    window_minutes INTEGER NOT NULL DEFAULT 0, -- Parents older than this take no children, 0 for no limit
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_alert_group_by CHECK (group_by IN ('label', 'service', 'source', 'alertmanager_group', 'time'))
+);
+
+-- A child alert points to its parent, only the parent pages
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS parent_id TEXT REFERENCES alerts(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS group_key TEXT; -- Grouping rule ID and the shared value
+
+CREATE INDEX IF NOT EXISTS idx_alerts_parent_id ON alerts(parent_id) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_alerts_open_group_key ON alerts(group_key, created_at)
+    WHERE group_key IS NOT NULL AND parent_id IS NULL AND status NOT IN ('resolved', 'closed');
+
+-- ROLLBACK:
+-- DROP INDEX idx_alerts_open_group_key;
+-- DROP INDEX idx_alerts_parent_id;
+-- ALTER TABLE alerts DROP COLUMN group_key;
+-- ALTER TABLE alerts DROP COLUMN parent_id;
+-- DROP TABLE alert_group_rules;
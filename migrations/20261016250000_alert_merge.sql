@@ -0,0 +1,14 @@
+-- Migration: Manual alert merge and unmerge
+-- Created: 2026-10-16
+
+-- A merged alert is closed into its target and can be split out again
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS merged_into TEXT REFERENCES alerts(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS merged_at TIMESTAMP;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS merged_status VARCHAR(20); -- Status before the merge, restored by unmerge
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS merged_tags TEXT[]; -- Tags the merge added to the target
+
+CREATE INDEX IF NOT EXISTS idx_alerts_merged_into ON alerts(merged_into) WHERE merged_into IS NOT NULL;
+
+-- ROLLBACK:
+-- DROP INDEX idx_alerts_merged_into;
+-- ALTER TABLE alerts DROP COLUMN merged_tags, DROP COLUMN merged_status, DROP COLUMN merged_at, DROP COLUMN merged_into;
@@ -0,0 +1,35 @@
+-- Migration: Maintenance windows
+-- Created: 2026-10-16
+
+-- Maintenance windows - planned work during which matching alerts page nobody
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    service_ids TEXT[] NOT NULL DEFAULT '{}', -- Uptime services, empty matches every alert
+    sources TEXT[] NOT NULL DEFAULT '{}', -- Alert sources, empty matches every source
+    labels JSONB NOT NULL DEFAULT '{}', -- Label values that must all match
+    starts_at TIMESTAMP NOT NULL, -- First occurrence
+    ends_at TIMESTAMP NOT NULL,
+    recurrence VARCHAR(10) NOT NULL DEFAULT '', -- Empty for one-off, daily, weekly
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- IANA zone recurring windows keep their wall-clock time in
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_maintenance_recurrence CHECK (recurrence IN ('', 'daily', 'weekly')),
+    CONSTRAINT valid_maintenance_range CHECK (ends_at > starts_at)
+);
+
+-- Alerts raised during a window are stored as suppressed and not paged
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS valid_alert_status;
+ALTER TABLE alerts ADD CONSTRAINT valid_alert_status
+    CHECK (status IN ('new', 'acked', 'escalated', 'snoozed', 'suppressed', 'resolved', 'closed')) NOT VALID;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS maintenance_window_id TEXT REFERENCES maintenance_windows(id) ON DELETE SET NULL;
+
+-- ROLLBACK:
+-- ALTER TABLE alerts DROP COLUMN maintenance_window_id;
+-- ALTER TABLE alerts DROP CONSTRAINT valid_alert_status;
+-- ALTER TABLE alerts ADD CONSTRAINT valid_alert_status CHECK (status IN ('new', 'acked', 'escalated', 'snoozed', 'resolved', 'closed')) NOT VALID;
+-- DROP TABLE maintenance_windows;
@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"log"
+	"os"
+)
+
+// NewDispatcherFromEnv registers a provider for every channel that is
+// configured through environment variables:
+//
+//	FCM_PROJECT_ID, FCM_CREDENTIALS_FILE, FCM_ACCESS_TOKEN, FCM_BASE_URL, FCM_TOKEN_URL
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM
+//	TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, TWILIO_FROM_NUMBER, TWILIO_BASE_URL
+//	WEBHOOK_URL, WEBHOOK_SECRET
+//	CHAT_WEBHOOK_URL
+func NewDispatcherFromEnv() *Dispatcher {
+	d := NewDispatcher()
+
+	if os.Getenv("FCM_CREDENTIALS_FILE") != "" || os.Getenv("FCM_ACCESS_TOKEN") != "" {
+		fcm, err := NewFCMProvider(FCMConfig{
+			BaseURL:         os.Getenv("FCM_BASE_URL"),
+			ProjectID:       os.Getenv("FCM_PROJECT_ID"),
+			CredentialsFile: os.Getenv("FCM_CREDENTIALS_FILE"),
+			TokenURL:        os.Getenv("FCM_TOKEN_URL"),
+			AccessToken:     os.Getenv("FCM_ACCESS_TOKEN"),
+		})
+		if err != nil {
+			log.Printf("Notifier: push disabled: %v", err)
+		} else {
+			d.Register(fcm)
+		}
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		d.Register(NewEmailProvider(SMTPConfig{
+			Host:     host,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}))
+	}
+
+	if sid := os.Getenv("TWILIO_ACCOUNT_SID"); sid != "" {
+		twilio := TwilioConfig{
+			BaseURL:    os.Getenv("TWILIO_BASE_URL"),
+			AccountSID: sid,
+			AuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+			FromNumber: os.Getenv("TWILIO_FROM_NUMBER"),
+		}
+		d.Register(NewTwilioSMSProvider(twilio))
+		d.Register(NewTwilioVoiceProvider(twilio))
+	}
+
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		d.Register(NewWebhookProvider(WebhookConfig{URL: url, Secret: os.Getenv("WEBHOOK_SECRET")}))
+	}
+
+	if url := os.Getenv("CHAT_WEBHOOK_URL"); url != "" {
+		d.Register(NewChatProvider(url))
+	}
+
+	log.Printf("Notifier: enabled channels %v", d.Channels())
+	return d
+}
@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Delivery is the outcome of sending one message over one channel
+type Delivery struct {
+	Channel string        `json:"channel"`
+	Result  Result        `json:"result"`
+	Err     error         `json:"-"`
+	Latency time.Duration `json:"latency"`
+}
+
+// Dispatcher routes messages to the provider registered for each channel
+type Dispatcher struct {
+	providers map[string]Provider
+}
+
+func NewDispatcher(providers ...Provider) *Dispatcher {
+	d := &Dispatcher{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		d.Register(p)
+	}
+	return d
+}
+
+// Register adds a provider, replacing any provider for the same channel
+func (d *Dispatcher) Register(p Provider) {
+	d.providers[p.Channel()] = p
+}
+
+// Channels lists the channels that have a provider
+func (d *Dispatcher) Channels() []string {
+	channels := make([]string, 0, len(d.providers))
+	for channel := range d.providers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// HasChannel reports whether a provider is registered for the channel
+func (d *Dispatcher) HasChannel(channel string) bool {
+	_, ok := d.providers[channel]
+	return ok
+}
+
+// Send delivers a message over a single channel
+func (d *Dispatcher) Send(ctx context.Context, channel string, recipient Recipient, msg Message) Delivery {
+	delivery := Delivery{Channel: channel}
+
+	provider, ok := d.providers[channel]
+	if !ok {
+		delivery.Err = fmt.Errorf("%w: %s", ErrUnknownChannel, channel)
+		return delivery
+	}
+
+	start := time.Now()
+	delivery.Result, delivery.Err = provider.Send(ctx, recipient, msg)
+	delivery.Latency = time.Since(start)
+	return delivery
+}
+
+// Notify delivers a message over each of the given channels
+func (d *Dispatcher) Notify(ctx context.Context, recipient Recipient, msg Message, channels ...string) []Delivery {
+	deliveries := make([]Delivery, 0, len(channels))
+	for _, channel := range channels {
+		deliveries = append(deliveries, d.Send(ctx, channel, recipient, msg))
+	}
+	return deliveries
+}
@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrInvalidAddress means an email address would break the message headers
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// SMTPConfig configures the email provider
+type SMTPConfig struct {
+	Host     string
+	Port     string // Default 587
+	Username string
+	Password string
+	From     string
+}
+
+// EmailProvider sends emails through an SMTP relay
+type EmailProvider struct {
+	config SMTPConfig
+}
+
+func NewEmailProvider(config SMTPConfig) *EmailProvider {
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	return &EmailProvider{config: config}
+}
+
+func (p *EmailProvider) Channel() string {
+	return ChannelEmail
+}
+
+func (p *EmailProvider) Send(ctx context.Context, recipient Recipient, msg Message) (Result, error) {
+	to := recipient.Email
+	if recipient.Address != "" {
+		to = recipient.Address
+	}
+	if to == "" {
+		return Result{}, ErrNoAddress
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return Result{}, ErrInvalidAddress
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", p.config.From)
+	fmt.Fprintf(&body, "To: %s\r\n", to)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject())))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n\r\n", msg.Description)
+	fmt.Fprintf(&body, "Alert: %s\r\nSeverity: %s\r\nSource: %s\r\n", msg.AlertID, msg.Severity, msg.Source)
+	if msg.Level > 0 {
+		fmt.Fprintf(&body, "Escalation level: %d\r\n", msg.Level)
+	}
+
+	var auth smtp.Auth
+	if p.config.Username != "" {
+		auth = smtp.PlainAuth("", p.config.Username, p.config.Password, p.config.Host)
+	}
+
+	// smtp.SendMail has no context support, run it in the background so the
+	// caller's deadline is still honoured
+	addr := net.JoinHostPort(p.config.Host, p.config.Port)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, p.config.From, []string{to}, []byte(body.String()))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return Result{Response: err.Error()}, err
+		}
+		return Result{Response: "accepted by " + addr}, nil
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// headerValue folds a value onto one line so it cannot start a new header
+func headerValue(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
@@ -0,0 +1,122 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// smtpServer accepts one message on a local port and hands back its DATA
+func smtpServer(t *testing.T) (string, string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				data <- msg.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return host, port, data
+}
+
+func TestEmailSubjectCannotInjectHeaders(t *testing.T) {
+	host, port, data := smtpServer(t)
+	provider := NewEmailProvider(SMTPConfig{Host: host, Port: port, From: "oncall@example.com"})
+
+	msg := Message{AlertID: "a1", Title: "Disk full\r\nBcc: victim@example.com\r\n\r\nfake body", Severity: "high"}
+	if _, err := provider.Send(context.Background(), Recipient{Email: "oncall-user@example.com"}, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(<-data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("title injected a Bcc header: %q", bcc)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader: %v", err)
+	}
+	if want := "[HIGH] Disk full Bcc: victim@example.com fake body"; subject != want {
+		t.Errorf("subject = %q, want %q", subject, want)
+	}
+}
+
+func TestEmailSubjectIsEncoded(t *testing.T) {
+	host, port, data := smtpServer(t)
+	provider := NewEmailProvider(SMTPConfig{Host: host, Port: port, From: "oncall@example.com"})
+
+	if _, err := provider.Send(context.Background(), Recipient{Email: "a@example.com"}, Message{Title: "Cơ sở dữ liệu ngừng"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(<-data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	raw := parsed.Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?utf-8?q?") {
+		t.Errorf("subject %q is not Q-encoded", raw)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(raw); subject != "Cơ sở dữ liệu ngừng" {
+		t.Errorf("subject = %q", subject)
+	}
+}
+
+func TestEmailRejectsAddressWithNewline(t *testing.T) {
+	provider := NewEmailProvider(SMTPConfig{Host: "127.0.0.1", Port: "1", From: "oncall@example.com"})
+	_, err := provider.Send(context.Background(), Recipient{Email: "a@example.com\r\nBcc: b@example.com"}, Message{Title: "x"})
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("err = %v, want ErrInvalidAddress", err)
+	}
+}
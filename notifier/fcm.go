@@ -0,0 +1,243 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCMConfig configures the FCM HTTP v1 provider
+type FCMConfig struct {
+	BaseURL         string // Default https://fcm.googleapis.com
+	ProjectID       string
+	CredentialsFile string // Service account JSON
+	TokenURL        string // Overrides token_uri from the credentials file
+	AccessToken     string // Static OAuth token, skips the service account flow
+}
+
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCMProvider sends push notifications through the FCM HTTP v1 API
+type FCMProvider struct {
+	config  FCMConfig
+	account *serviceAccount
+	key     *rsa.PrivateKey
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewFCMProvider(config FCMConfig) (*FCMProvider, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://fcm.googleapis.com"
+	}
+	p := &FCMProvider{config: config, token: config.AccessToken}
+	if config.AccessToken != "" {
+		// Static tokens never expire from our point of view
+		p.tokenExpiry = time.Now().AddDate(100, 0, 0)
+	}
+
+	if config.CredentialsFile != "" {
+		b, err := os.ReadFile(config.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+		}
+		var account serviceAccount
+		if err := json.Unmarshal(b, &account); err != nil {
+			return nil, fmt.Errorf("failed to parse FCM credentials: %w", err)
+		}
+		key, err := parsePrivateKey(account.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		p.account = &account
+		p.key = key
+		if p.config.ProjectID == "" {
+			p.config.ProjectID = account.ProjectID
+		}
+		if p.config.TokenURL == "" {
+			p.config.TokenURL = account.TokenURI
+		}
+	}
+
+	if p.config.ProjectID == "" {
+		return nil, errors.New("FCM project ID is required")
+	}
+	if p.token == "" && p.account == nil {
+		return nil, errors.New("FCM requires a credentials file or an access token")
+	}
+	return p, nil
+}
+
+func (p *FCMProvider) Channel() string {
+	return ChannelPush
+}
+
+func (p *FCMProvider) Send(ctx context.Context, recipient Recipient, msg Message) (Result, error) {
+	if recipient.FCMToken == "" {
+		return Result{}, ErrNoAddress
+	}
+
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	payload := map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": recipient.FCMToken,
+			"notification": map[string]string{
+				"title": msg.Subject(),
+				"body":  msg.Description,
+			},
+			"data": map[string]string{
+				"alert_id": msg.AlertID,
+				"severity": msg.Severity,
+				"source":   msg.Source,
+				"status":   msg.Status,
+				"level":    fmt.Sprint(msg.Level),
+			},
+			"android": map[string]string{"priority": "high"},
+			"apns": map[string]interface{}{
+				"headers": map[string]string{"apns-priority": "10"},
+			},
+		},
+	}
+	body, _ := json.Marshal(payload)
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", strings.TrimRight(p.config.BaseURL, "/"), p.config.ProjectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := readResponse(resp)
+	if err == nil {
+		var sent struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal([]byte(result.Response), &sent) == nil {
+			result.MessageID = sent.Name
+		}
+	}
+	return result, err
+}
+
+// accessToken returns a cached OAuth token, exchanging a signed service
+// account assertion for a new one when it is about to expire
+func (p *FCMProvider) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Until(p.tokenExpiry) > time.Minute {
+		return p.token, nil
+	}
+	if p.account == nil {
+		return "", errors.New("FCM access token expired and no credentials are configured")
+	}
+
+	assertion, err := p.signAssertion()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch FCM access token: %w", err)
+	}
+	result, err := readResponse(resp)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch FCM access token: %w", err)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(result.Response), &token); err != nil || token.AccessToken == "" {
+		return "", errors.New("invalid FCM access token response")
+	}
+
+	p.token = token.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return p.token, nil
+}
+
+// signAssertion builds the RS256 JWT used in the OAuth JWT bearer flow
+func (p *FCMProvider) signAssertion() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   p.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.config.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM assertion: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parsePrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("invalid FCM private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("FCM private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notification channels
+const (
+	ChannelPush    = "push"
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelVoice   = "voice"
+	ChannelChat    = "chat"
+	ChannelWebhook = "webhook"
+)
+
+var (
+	// ErrNoAddress means the recipient has no address for the channel
+	// (no FCM token for push, no phone for SMS, ...)
+	ErrNoAddress = errors.New("recipient has no address for this channel")
+	// ErrUnknownChannel means no provider is registered for the channel
+	ErrUnknownChannel = errors.New("no provider registered for channel")
+)
+
+// Message is what gets sent, independent of the channel
+type Message struct {
+	AlertID     string `json:"alert_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Source      string `json:"source"`
+	Status      string `json:"status"`
+	Level       int    `json:"escalation_level,omitempty"`
+}
+
+// Subject is a one-line summary used for push titles, email subjects and SMS
+func (m Message) Subject() string {
+	if m.Severity == "" {
+		return m.Title
+	}
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(m.Severity), m.Title)
+}
+
+// Recipient carries the contact details of the person (or room) being paged
+type Recipient struct {
+	UserID   string `json:"user_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	FCMToken string `json:"-"`
+	Address  string `json:"address,omitempty"` // Channel specific override, e.g. a webhook URL
+}
+
+// Result is what the provider answered
+type Result struct {
+	StatusCode int    `json:"status_code,omitempty"`
+	MessageID  string `json:"message_id,omitempty"`
+	Response   string `json:"response,omitempty"`
+}
+
+// Provider delivers messages over one channel
+type Provider interface {
+	Channel() string
+	Send(ctx context.Context, recipient Recipient, msg Message) (Result, error)
+}
+
+// Helper functions
+
+const maxResponseSize = 1024
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// readResponse reads a (truncated) provider response and turns non-2xx
+// status codes into errors
+func readResponse(resp *http.Response) (Result, error) {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+
+	result := Result{StatusCode: resp.StatusCode, Response: string(body)}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("provider returned status %d", resp.StatusCode)
+	}
+	return result, nil
+}
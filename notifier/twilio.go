@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// TwilioConfig configures the Twilio-compatible SMS and voice providers
+type TwilioConfig struct {
+	BaseURL    string // Default https://api.twilio.com
+	AccountSID string
+	AuthToken  string
+	FromNumber string
+}
+
+// TwilioProvider sends SMS or places voice calls through the Twilio REST API
+type TwilioProvider struct {
+	config  TwilioConfig
+	channel string
+}
+
+func NewTwilioSMSProvider(config TwilioConfig) *TwilioProvider {
+	return newTwilioProvider(config, ChannelSMS)
+}
+
+func NewTwilioVoiceProvider(config TwilioConfig) *TwilioProvider {
+	return newTwilioProvider(config, ChannelVoice)
+}
+
+func newTwilioProvider(config TwilioConfig, channel string) *TwilioProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.twilio.com"
+	}
+	return &TwilioProvider{config: config, channel: channel}
+}
+
+func (p *TwilioProvider) Channel() string {
+	return p.channel
+}
+
+func (p *TwilioProvider) Send(ctx context.Context, recipient Recipient, msg Message) (Result, error) {
+	to := recipient.Phone
+	if recipient.Address != "" {
+		to = recipient.Address
+	}
+	if to == "" {
+		return Result{}, ErrNoAddress
+	}
+
+	form := url.Values{
+		"To":   {to},
+		"From": {p.config.FromNumber},
+	}
+	resource := "Messages.json"
+	if p.channel == ChannelVoice {
+		resource = "Calls.json"
+		form.Set("Twiml", voiceTwiml(msg))
+	} else {
+		form.Set("Body", truncate(msg.Subject()+" - "+msg.Description, 320))
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s", strings.TrimRight(p.config.BaseURL, "/"), p.config.AccountSID, resource)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Result{}, err
+	}
+	req.SetBasicAuth(p.config.AccountSID, p.config.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := readResponse(resp)
+	if err == nil {
+		var created struct {
+			SID string `json:"sid"`
+		}
+		if json.Unmarshal([]byte(result.Response), &created) == nil {
+			result.MessageID = created.SID
+		}
+	}
+	return result, err
+}
+
+// voiceTwiml reads the alert out twice so it is not missed on pickup
+func voiceTwiml(msg Message) string {
+	var text strings.Builder
+	xml.EscapeText(&text, []byte(fmt.Sprintf("Alert. %s. %s.", msg.Subject(), msg.Description)))
+	say := "<Say>" + text.String() + "</Say>"
+	return "<Response>" + say + "<Pause length=\"1\"/>" + say + "</Response>"
+}
+
+// truncate shortens s to at most n bytes, cutting on a rune boundary so the
+// result stays valid UTF-8
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	end := 0
+	for end < len(s) {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		if end+size > n-3 {
+			break
+		}
+		end += size
+	}
+	return s[:end] + "..."
+}
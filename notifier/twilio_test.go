@@ -0,0 +1,57 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKeepsRunesWhole(t *testing.T) {
+	title := strings.Repeat("Máy chủ 数据库 ngừng 🔥 ", 20)
+	for n := 4; n <= 64; n++ {
+		got := truncate(title, n)
+		if !utf8.ValidString(got) {
+			t.Fatalf("truncate(%d) = %q is not valid UTF-8", n, got)
+		}
+		if len(got) > n {
+			t.Fatalf("truncate(%d) is %d bytes", n, len(got))
+		}
+		if !strings.HasSuffix(got, "...") || !strings.HasPrefix(title, strings.TrimSuffix(got, "...")) {
+			t.Fatalf("truncate(%d) = %q is not a prefix of the title", n, got)
+		}
+	}
+	if got := truncate("short", 320); got != "short" {
+		t.Errorf("truncate of a short string = %q", got)
+	}
+}
+
+func TestSMSBodyWithMultibyteTitleIsValidUTF8(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		body = r.PostForm.Get("Body")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM123"}`))
+	}))
+	defer server.Close()
+
+	provider := NewTwilioSMSProvider(TwilioConfig{BaseURL: server.URL, AccountSID: "AC1", AuthToken: "t", FromNumber: "+10000000000"})
+	// "[HIGH] " and 3-byte runes put the byte limit inside a rune
+	msg := Message{Title: strings.Repeat("数据库", 100), Severity: "high"}
+	result, err := provider.Send(context.Background(), Recipient{Phone: "+84900000000"}, msg)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if result.MessageID != "SM123" {
+		t.Errorf("message ID = %q", result.MessageID)
+	}
+	if !utf8.ValidString(body) {
+		t.Fatalf("SMS body %q is not valid UTF-8", body)
+	}
+	if len(body) > 320 || !strings.HasSuffix(body, "...") {
+		t.Errorf("SMS body is %d bytes: %q", len(body), body)
+	}
+}
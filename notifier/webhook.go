@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookConfig configures the generic outbound webhook provider
+type WebhookConfig struct {
+	URL    string
+	Secret string // Signs the body with HMAC-SHA256 when set
+}
+
+// WebhookProvider POSTs the alert as JSON to an arbitrary endpoint
+type WebhookProvider struct {
+	config WebhookConfig
+}
+
+func NewWebhookProvider(config WebhookConfig) *WebhookProvider {
+	return &WebhookProvider{config: config}
+}
+
+func (p *WebhookProvider) Channel() string {
+	return ChannelWebhook
+}
+
+func (p *WebhookProvider) Send(ctx context.Context, recipient Recipient, msg Message) (Result, error) {
+	endpoint := p.config.URL
+	if recipient.Address != "" {
+		endpoint = recipient.Address
+	}
+	if endpoint == "" {
+		return Result{}, ErrNoAddress
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":     "alert.notification",
+		"alert":     msg,
+		"recipient": recipient,
+		"sent_at":   time.Now().UTC(),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Slar-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	return readResponse(resp)
+}
+
+// ChatProvider posts to a Slack-compatible incoming webhook
+type ChatProvider struct {
+	webhookURL string
+}
+
+func NewChatProvider(webhookURL string) *ChatProvider {
+	return &ChatProvider{webhookURL: webhookURL}
+}
+
+func (p *ChatProvider) Channel() string {
+	return ChannelChat
+}
+
+func (p *ChatProvider) Send(ctx context.Context, recipient Recipient, msg Message) (Result, error) {
+	endpoint := p.webhookURL
+	if recipient.Address != "" {
+		endpoint = recipient.Address
+	}
+	if endpoint == "" {
+		return Result{}, ErrNoAddress
+	}
+
+	text := fmt.Sprintf("*%s*\n%s\nAlert `%s` from %s", msg.Subject(), msg.Description, msg.AlertID, msg.Source)
+	if recipient.Name != "" {
+		text += " - paging " + recipient.Name
+	}
+	body, _ := json.Marshal(map[string]string{"text": text})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	return readResponse(resp)
+}
@@ -7,27 +7,55 @@ import (
 	"github.com/go-redis/redis/v8"
 
 	"github.com/vanchonlee/oncallkit/handlers"
+	"github.com/vanchonlee/oncallkit/notifier"
 	"github.com/vanchonlee/oncallkit/services"
 )
 
-func NewGinRouter(pg *sql.DB, redis *redis.Client) *gin.Engine {
+func NewGinRouter(pg *sql.DB, redis *redis.Client, dispatcher *notifier.Dispatcher) *gin.Engine {
 	r := gin.Default()
 
 	// Initialize services
 	alertService := services.NewAlertService(pg, redis)
+	alertEventService := services.NewAlertEventService(pg, redis)
+	alertNoteService := services.NewAlertNoteService(pg, redis)
 	userService := services.NewUserService(pg, redis)
 	uptimeService := services.NewUptimeService(pg, redis)
 	alertManagerService := services.NewAlertManagerService(pg, alertService)
 	authService := services.NewAuthService(pg, redis)
 	apiKeyService := services.NewAPIKeyService(pg)
+	escalationService := services.NewEscalationService(pg, redis)
+	notificationRuleService := services.NewNotificationRuleService(pg, redis, dispatcher)
+	notificationService := services.NewNotificationService(pg, redis, dispatcher)
+	rotationService := services.NewRotationService(pg, redis)
+	overrideService := services.NewOverrideService(pg, redis)
+	calendarService := services.NewCalendarService(pg, redis)
+	coverageService := services.NewCoverageService(pg, redis)
+	teamService := services.NewTeamService(pg, redis)
+	alertPolicyService := services.NewAlertPolicyService(pg, redis)
+	alertStreamService := services.NewAlertStreamService(redis)
+	alertGroupService := services.NewAlertGroupService(pg, redis)
+	maintenanceService := services.NewMaintenanceService(pg, redis)
 
 	// Initialize handlers
-	alertHandler := handlers.NewAlertHandler(alertService)
+	alertHandler := handlers.NewAlertHandler(alertService, alertEventService)
+	alertNoteHandler := handlers.NewAlertNoteHandler(alertNoteService)
 	userHandler := handlers.NewUserHandler(userService)
 	uptimeHandler := handlers.NewUptimeHandler(uptimeService)
 	alertManagerHandler := handlers.NewAlertManagerHandler(alertManagerService)
 	authHandler := handlers.NewAuthHandler(authService)
-	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, alertService, userService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, alertService, alertPolicyService, userService)
+	escalationHandler := handlers.NewEscalationHandler(escalationService)
+	notificationRuleHandler := handlers.NewNotificationRuleHandler(notificationRuleService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	rotationHandler := handlers.NewRotationHandler(rotationService, userService)
+	overrideHandler := handlers.NewOverrideHandler(overrideService)
+	calendarHandler := handlers.NewCalendarHandler(calendarService)
+	coverageHandler := handlers.NewCoverageHandler(coverageService)
+	teamHandler := handlers.NewTeamHandler(teamService, userService)
+	alertPolicyHandler := handlers.NewAlertPolicyHandler(alertPolicyService)
+	alertStreamHandler := handlers.NewAlertStreamHandler(alertStreamService)
+	alertGroupHandler := handlers.NewAlertGroupHandler(alertGroupService)
+	maintenanceHandler := handlers.NewMaintenanceHandler(maintenanceService)
 
 	// Initialize middleware
 	authMiddleware := handlers.NewAuthMiddleware(authService.JWTService)
@@ -37,13 +65,45 @@ func NewGinRouter(pg *sql.DB, redis *redis.Client) *gin.Engine {
 	r.POST("/auth/change-password", authHandler.ChangePassword)
 	r.POST("/auth/setup-admin", authHandler.SetupAdmin)
 
-	// ALERTS
-	r.GET("/alerts", alertHandler.ListAlerts)
-	r.POST("/alerts", alertHandler.CreateAlert)
-	r.GET("/alerts/:id", alertHandler.GetAlert)
-	r.POST("/alerts/:id/ack", alertHandler.AckAlert)
-	r.POST("/alerts/:id/unack", alertHandler.UnackAlert)
-	r.POST("/alerts/:id/close", alertHandler.CloseAlert)
+	// ALERTS (a JWT is optional, it names the user in the alert timeline)
+	alertRoutes := r.Group("/alerts")
+	alertRoutes.Use(authMiddleware.OptionalAuthMiddleware())
+	{
+		alertRoutes.GET("", alertHandler.ListAlerts)
+		alertRoutes.POST("", alertHandler.CreateAlert)
+		alertRoutes.POST("/bulk", alertHandler.BulkAction)
+		alertRoutes.GET("/stream", authMiddleware.StreamAuthMiddleware(), alertStreamHandler.StreamAlerts)
+		alertRoutes.GET("/stream/ws", authMiddleware.StreamAuthMiddleware(), alertStreamHandler.StreamAlertsWebSocket)
+		alertRoutes.GET("/:id", alertHandler.GetAlert)
+		alertRoutes.POST("/:id/ack", alertHandler.AckAlert)
+		alertRoutes.POST("/:id/unack", alertHandler.UnackAlert)
+		alertRoutes.POST("/:id/snooze", alertHandler.SnoozeAlert)
+		alertRoutes.POST("/:id/resolve", alertHandler.ResolveAlert)
+		alertRoutes.POST("/:id/close", alertHandler.CloseAlert)
+		alertRoutes.POST("/:id/reopen", alertHandler.ReopenAlert)
+		alertRoutes.GET("/:id/notifications", notificationHandler.ListAlertNotifications)
+		alertRoutes.GET("/:id/timeline", alertHandler.GetTimeline)
+
+		// Reassign, escalate by hand and page more people
+		alertRoutes.POST("/:id/assign", alertHandler.AssignAlert)
+		alertRoutes.POST("/:id/escalate", alertHandler.EscalateAlert)
+		alertRoutes.GET("/:id/responders", alertHandler.ListResponders)
+		alertRoutes.POST("/:id/responders", alertHandler.AddResponders)
+		alertRoutes.GET("/:id/children", alertGroupHandler.ListChildren)
+		alertRoutes.POST("/:id/merge", alertHandler.MergeAlerts)
+		alertRoutes.POST("/:id/unmerge", alertHandler.UnmergeAlerts)
+
+		// Notes (JWT required to write), tags and details
+		alertRoutes.GET("/:id/notes", alertNoteHandler.ListNotes)
+		alertRoutes.POST("/:id/notes", alertNoteHandler.CreateNote)
+		alertRoutes.PUT("/:id/notes/:noteId", alertNoteHandler.UpdateNote)
+		alertRoutes.DELETE("/:id/notes/:noteId", alertNoteHandler.DeleteNote)
+		alertRoutes.PUT("/:id/tags", alertHandler.SetTags)
+		alertRoutes.POST("/:id/tags", alertHandler.AddTags)
+		alertRoutes.DELETE("/:id/tags/:tag", alertHandler.RemoveTag)
+		alertRoutes.PATCH("/:id/details", alertHandler.UpdateDetails)
+		alertRoutes.DELETE("/:id/details/:key", alertHandler.DeleteDetail)
+	}
 
 	// ALERTMANAGER INTEGRATION
 	r.POST("/alertmanager/webhook", alertManagerHandler.ReceiveWebhook)
@@ -62,6 +122,14 @@ func NewGinRouter(pg *sql.DB, redis *redis.Client) *gin.Engine {
 		apiKeyRoutes.GET("/stats", apiKeyHandler.GetAPIKeyStats)
 	}
 
+	// NOTIFICATION DEAD LETTERS (requires admin)
+	deadLetterRoutes := r.Group("/admin/notifications/dead-letters")
+	deadLetterRoutes.Use(authMiddleware.JWTAuthMiddleware(), authMiddleware.AdminOnlyMiddleware())
+	{
+		deadLetterRoutes.GET("", notificationHandler.ListDeadLetters)
+		deadLetterRoutes.POST("/:id/replay", notificationHandler.ReplayDeadLetter)
+	}
+
 	// WEBHOOK ENDPOINTS (uses API key authentication)
 	r.POST("/alert/webhook", apiKeyHandler.WebhookAlert)
 
@@ -72,10 +140,89 @@ func NewGinRouter(pg *sql.DB, redis *redis.Client) *gin.Engine {
 	r.PUT("/users/:id", userHandler.UpdateUser)
 	r.DELETE("/users/:id", userHandler.DeleteUser)
 
+	// NOTIFICATION PREFERENCES
+	r.GET("/users/:id/contact-methods", notificationRuleHandler.ListContactMethods)
+	r.POST("/users/:id/contact-methods", notificationRuleHandler.CreateContactMethod)
+	r.DELETE("/users/:id/contact-methods/:methodId", notificationRuleHandler.DeleteContactMethod)
+	r.POST("/users/:id/contact-methods/:methodId/send-verification", notificationRuleHandler.SendVerification)
+	r.POST("/users/:id/contact-methods/:methodId/verify", notificationRuleHandler.VerifyContactMethod)
+	r.GET("/users/:id/notification-rules", notificationRuleHandler.ListRules)
+	r.POST("/users/:id/notification-rules", notificationRuleHandler.CreateRule)
+	r.PUT("/users/:id/notification-rules/:ruleId", notificationRuleHandler.UpdateRule)
+	r.DELETE("/users/:id/notification-rules/:ruleId", notificationRuleHandler.DeleteRule)
+
+	// TEAMS
+	r.GET("/teams", teamHandler.ListTeams)
+	r.POST("/teams", teamHandler.CreateTeam)
+	r.GET("/teams/:id", teamHandler.GetTeam)
+	r.PUT("/teams/:id", teamHandler.UpdateTeam)
+	r.DELETE("/teams/:id", teamHandler.DeleteTeam)
+	r.GET("/teams/:id/oncall", teamHandler.GetCurrentOnCall)
+	r.GET("/teams/:id/routing-rules", teamHandler.ListRoutingRules)
+	r.POST("/teams/:id/routing-rules", teamHandler.CreateRoutingRule)
+	r.DELETE("/teams/:id/routing-rules/:ruleId", teamHandler.DeleteRoutingRule)
+
 	// ON-CALL
 	r.GET("/oncall/current", userHandler.GetCurrentOnCallUser)
 	r.GET("/oncall/schedules", userHandler.ListOnCallSchedules)
 	r.POST("/oncall/schedules", userHandler.CreateOnCallSchedule)
+	r.POST("/oncall/schedules/import", calendarHandler.ImportCalendar)
+	r.GET("/oncall/schedules/:id/calendar.ics", calendarHandler.RotationCalendar)
+	r.GET("/oncall/users/:id/calendar.ics", calendarHandler.UserCalendar)
+	r.GET("/oncall/coverage", coverageHandler.GetCoverage)
+	r.GET("/oncall/rotations", rotationHandler.ListRotations)
+	r.POST("/oncall/rotations", rotationHandler.CreateRotation)
+	r.GET("/oncall/rotations/:id", rotationHandler.GetRotation)
+	r.PUT("/oncall/rotations/:id", rotationHandler.UpdateRotation)
+	r.DELETE("/oncall/rotations/:id", rotationHandler.DeleteRotation)
+	r.GET("/oncall/rotations/:id/current", rotationHandler.GetCurrentOnCall)
+	r.GET("/oncall/rotations/:id/shifts", rotationHandler.ListShifts)
+
+	// OVERRIDES AND SHIFT SWAPS (requires JWT authentication, changes are recorded per user)
+	oncallRoutes := r.Group("/oncall")
+	oncallRoutes.Use(authMiddleware.JWTAuthMiddleware())
+	{
+		oncallRoutes.GET("/rotations/:id/overrides", overrideHandler.ListOverrides)
+		oncallRoutes.POST("/rotations/:id/overrides", overrideHandler.CreateOverride)
+		oncallRoutes.DELETE("/rotations/:id/overrides/:overrideId", overrideHandler.CancelOverride)
+		oncallRoutes.GET("/swaps", overrideHandler.ListSwaps)
+		oncallRoutes.POST("/swaps", overrideHandler.ProposeSwap)
+		oncallRoutes.POST("/swaps/:id/accept", overrideHandler.AcceptSwap)
+		oncallRoutes.POST("/swaps/:id/decline", overrideHandler.DeclineSwap)
+		oncallRoutes.POST("/swaps/:id/cancel", overrideHandler.CancelSwap)
+	}
+
+	// ESCALATION POLICIES
+	r.GET("/escalation-policies", escalationHandler.ListPolicies)
+	r.POST("/escalation-policies", escalationHandler.CreatePolicy)
+	r.GET("/escalation-policies/:id", escalationHandler.GetPolicy)
+	r.PUT("/escalation-policies/:id", escalationHandler.UpdatePolicy)
+	r.DELETE("/escalation-policies/:id", escalationHandler.DeletePolicy)
+
+	// ALERT POLICIES (auto-resolve and auto-close)
+	r.GET("/alert-policies", alertPolicyHandler.ListPolicies)
+	r.POST("/alert-policies", alertPolicyHandler.CreatePolicy)
+	r.GET("/alert-policies/:id", alertPolicyHandler.GetPolicy)
+	r.PUT("/alert-policies/:id", alertPolicyHandler.UpdatePolicy)
+	r.DELETE("/alert-policies/:id", alertPolicyHandler.DeletePolicy)
+
+	// ALERT GROUPING (related alerts under one paging parent)
+	r.GET("/alert-group-rules", alertGroupHandler.ListRules)
+	r.POST("/alert-group-rules", alertGroupHandler.CreateRule)
+	r.GET("/alert-group-rules/:id", alertGroupHandler.GetRule)
+	r.PUT("/alert-group-rules/:id", alertGroupHandler.UpdateRule)
+	r.DELETE("/alert-group-rules/:id", alertGroupHandler.DeleteRule)
+
+	// MAINTENANCE WINDOWS (suppress alerts and uptime incidents)
+	maintenanceRoutes := r.Group("/maintenance-windows")
+	maintenanceRoutes.Use(authMiddleware.OptionalAuthMiddleware())
+	{
+		maintenanceRoutes.GET("", maintenanceHandler.ListWindows)
+		maintenanceRoutes.POST("", maintenanceHandler.CreateWindow)
+		maintenanceRoutes.GET("/:id", maintenanceHandler.GetWindow)
+		maintenanceRoutes.PUT("/:id", maintenanceHandler.UpdateWindow)
+		maintenanceRoutes.DELETE("/:id", maintenanceHandler.DeleteWindow)
+	}
 
 	// UPTIME MONITORING
 	r.GET("/uptime", uptimeHandler.GetUptimeDashboard)
@@ -90,7 +237,5 @@ func NewGinRouter(pg *sql.DB, redis *redis.Client) *gin.Engine {
 		c.JSON(200, gin.H{"message": "Dashboard endpoint - TODO implement"})
 	})
 
-	// TODO: notes, tags, log, recipients endpoints
-
 	return r
 }
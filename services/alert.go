@@ -3,147 +3,416 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/vanchonlee/oncallkit/db"
 )
 
 type AlertService struct {
-	PG    *sql.DB
-	Redis *redis.Client
+	PG        *sql.DB
+	Redis     *redis.Client
+	Scheduler *JobScheduler
 }
 
 func NewAlertService(pg *sql.DB, redis *redis.Client) *AlertService {
-	return &AlertService{PG: pg, Redis: redis}
+	return &AlertService{PG: pg, Redis: redis, Scheduler: NewJobScheduler(redis)}
 }
 
-func (s *AlertService) ListAlerts() ([]db.AlertResponse, error) {
-	query := `
-		SELECT 
-			a.id, a.title, a.description, a.status, a.created_at, a.updated_at, 
-			a.severity, a.source, a.assigned_to, a.assigned_at,
-			u.name, u.email
-		FROM alerts a
-		LEFT JOIN users u ON a.assigned_to = u.id
-		ORDER BY a.created_at DESC 
-		LIMIT 100
-	`
+// AlertRoute carries what routing looks at besides the alert itself
+type AlertRoute struct {
+	Labels    map[string]string // Matched by label routing rules
+	APIKeyID  string            // Key the alert was sent with
+	ServiceID string            // Uptime service that raised the alert
+	UserID    string            // Signed-in user who raised the alert
+	GroupKey  string            // AlertManager group key, for grouping rules
+}
+
+// alertSelect loads alerts with the name and email of the assignee
+const alertSelect = `
+	SELECT 
+		a.id, a.title, a.description, a.status, a.created_at, a.updated_at, 
+		a.severity, a.source, a.assigned_to, a.assigned_at, COALESCE(a.team_id, ''), COALESCE(a.dedup_key, ''), a.count,
+		COALESCE(a.author, ''), a.tags, a.details,
+		COALESCE(a.acked_by, ''), a.acked_at, COALESCE(a.resolved_by, ''), a.resolved_at, COALESCE(a.closed_by, ''), a.closed_at, a.snoozed_until,
+		a.escalation_policy_id, a.escalation_level, a.escalated_at,
+		COALESCE(a.parent_id, ''), (SELECT COUNT(*) FROM alerts c WHERE c.parent_id = a.id), COALESCE(a.merged_into, ''),
+		COALESCE(a.maintenance_window_id, ''),
+		u.name, u.email
+	FROM alerts a
+	LEFT JOIN users u ON a.assigned_to = u.id
+`
+
+// Page sizes of ListAlerts
+const (
+	defaultAlertPageSize = 100
+	maxAlertPageSize     = 1000
+)
+
+// ErrInvalidCursor means a cursor was not returned by ListAlerts
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// AlertFilter narrows ListAlerts. Empty fields match every alert; list
+// fields match any of their values, except Tags where every tag must match.
+type AlertFilter struct {
+	Statuses   []string
+	Severities []string
+	Sources    []string
+	AssignedTo string
+	TeamID     string
+	Tags       []string
+	From, To   *time.Time // created_at range, To excluded
+	Search     string     // Full-text search over title and description
+	Limit      int
+	Cursor     string // NextCursor of the previous page
+}
+
+// ListAlerts returns one page of the alerts matching the filter, newest first
+func (s *AlertService) ListAlerts(filter AlertFilter) (db.AlertList, error) {
+	list := db.AlertList{Alerts: []db.AlertResponse{}, Limit: filter.Limit}
+	if list.Limit <= 0 || list.Limit > maxAlertPageSize {
+		list.Limit = defaultAlertPageSize
+	}
+
+	where, args := alertFilterWhere(filter)
+	if err := s.PG.QueryRow(`SELECT COUNT(*) FROM alerts a WHERE `+where, args...).Scan(&list.Total); err != nil {
+		return list, err
+	}
+
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeAlertCursor(filter.Cursor)
+		if err != nil {
+			return list, err
+		}
+		args = append(args, createdAt, id)
+		where += fmt.Sprintf(" AND (a.created_at, a.id) < ($%d, $%d)", len(args)-1, len(args))
+	}
 
-	rows, err := s.PG.Query(query)
+	// One extra row tells whether there is a next page
+	args = append(args, list.Limit+1)
+	rows, err := s.PG.Query(alertSelect+`WHERE `+where+fmt.Sprintf(` ORDER BY a.created_at DESC, a.id DESC LIMIT $%d`, len(args)), args...)
 	if err != nil {
-		return nil, err
+		return list, err
 	}
 	defer rows.Close()
 
-	var alerts []db.AlertResponse
 	for rows.Next() {
-		var a db.AlertResponse
-		var assignedTo sql.NullString
-		var assignedAt sql.NullTime
-		var userName sql.NullString
-		var userEmail sql.NullString
-
-		err := rows.Scan(
-			&a.ID, &a.Title, &a.Description, &a.Status, &a.CreatedAt, &a.UpdatedAt,
-			&a.Severity, &a.Source, &assignedTo, &assignedAt,
-			&userName, &userEmail,
-		)
+		a, err := scanAlert(rows)
 		if err != nil {
 			continue
 		}
+		list.Alerts = append(list.Alerts, a)
+	}
 
-		if assignedTo.Valid {
-			a.AssignedTo = assignedTo.String
-		}
-		if assignedAt.Valid {
-			a.AssignedAt = &assignedAt.Time
-		}
-		if userName.Valid {
-			a.AssignedToName = userName.String
-		}
-		if userEmail.Valid {
-			a.AssignedToEmail = userEmail.String
-		}
-
-		alerts = append(alerts, a)
+	if len(list.Alerts) > list.Limit {
+		list.Alerts = list.Alerts[:list.Limit]
+		last := list.Alerts[len(list.Alerts)-1]
+		list.NextCursor = encodeAlertCursor(last.CreatedAt, last.ID)
 	}
-	return alerts, nil
+	return list, nil
 }
 
-func (s *AlertService) CreateAlertFromRequest(c *gin.Context) (db.Alert, error) {
+// CreateAlertFromRequest creates the alert of a POST /alerts request and
+// reports whether a new alert was opened. A request with status "resolved"
+// is a resolve event for its dedup_key, handed to the alert policies.
+func (s *AlertService) CreateAlertFromRequest(c *gin.Context) (db.Alert, bool, error) {
 	var alert db.Alert
 	if err := c.ShouldBindJSON(&alert); err != nil {
-		return alert, err
+		return alert, false, err
 	}
-	alert.ID = uuid.New().String()
-	alert.Status = "new"
-	alert.CreatedAt = time.Now()
-	alert.UpdatedAt = time.Now()
-
-	// Auto-assign to current on-call user
-	userService := NewUserService(s.PG, s.Redis)
-	onCallUser, err := userService.GetCurrentOnCallUser()
-	if err == nil {
-		alert.AssignedTo = onCallUser.ID
-		now := time.Now()
-		alert.AssignedAt = &now
+	if alert.Status == db.AlertStatusResolved {
+		resolved, _, err := NewAlertPolicyService(s.PG, s.Redis).ResolveEvent(alert.DedupKey, alert.Source)
+		if err != nil {
+			return alert, false, err
+		}
+		return AlertFromResponse(resolved), false, nil
 	}
+	alert.Status = db.AlertStatusNew
+	alert.Author = c.GetString("user_id")
 
-	_, err = s.PG.Exec(`INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source, assigned_to, assigned_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
-		alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt, alert.Severity, alert.Source, alert.AssignedTo, alert.AssignedAt)
+	// Clients may name the team, everything else is decided by routing
+	alert.AssignedTo, alert.AssignedAt, alert.EscalationPolicyID, alert.ParentID, alert.MaintenanceWindowID = "", nil, "", "", ""
+	alert.CreatedAt = time.Time{}
+	created, err := s.CreateRoutedAlert(&alert, AlertRoute{UserID: alert.Author})
 	if err != nil {
-		return alert, err
+		return alert, false, err
 	}
-	b, _ := json.Marshal(alert)
-	s.Redis.RPush(context.Background(), "alerts:queue", b)
-	return alert, nil
+	// A repeated dedup_key updates the open alert instead of creating one
+	return *created, created.Count == 1, nil
 }
 
 // CreateAlert creates a new alert from an Alert struct
 func (s *AlertService) CreateAlert(alert *db.Alert) (*db.Alert, error) {
+	return s.CreateRoutedAlert(alert, AlertRoute{})
+}
+
+// CreateRoutedAlert creates an alert, routing it to a team by its source and
+// the given labels or API key first. While an alert with the same dedup key
+// is not resolved or closed, the event only bumps that alert's count and
+// updated_at; the returned alert is then the existing one, with a count
+// above 1. A new alert sharing its group key with an open alert becomes a
+// child of that alert and pages nobody. An alert raised during a matching
+// maintenance window is stored as suppressed and pages nobody either; a
+// repeated event after the window ended pages it as a new alert.
+func (s *AlertService) CreateRoutedAlert(alert *db.Alert, route AlertRoute) (*db.Alert, error) {
 	alert.ID = uuid.New().String()
-	alert.CreatedAt = time.Now()
+	alert.Count = 1
+	// Sources may say when the alert started firing, AlertManager does
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
 	alert.UpdatedAt = time.Now()
+	alert.Tags = normalizeTags(alert.Tags)
+	if alert.Details == nil {
+		alert.Details = map[string]interface{}{}
+	}
+	details, err := json.Marshal(alert.Details)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.RouteAlert(alert, route); err != nil {
+		return nil, err
+	}
+	window, suppressed, err := NewMaintenanceService(s.PG, s.Redis).ActiveWindow(alert.Source, route, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	alert.GroupKey, alert.ParentID, alert.MaintenanceWindowID = "", "", ""
+	var since time.Time
+	if suppressed {
+		// Suppressed alerts stay out of groups, a parent would page for them
+		alert.Status, alert.MaintenanceWindowID = db.AlertStatusSuppressed, window.ID
+	} else if alert.GroupKey, since, err = NewAlertGroupService(s.PG, s.Redis).GroupKey(alert, route); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if alert.GroupKey != "" {
+		if alert.ParentID, err = groupParent(tx, alert.GroupKey, since); err != nil {
+			return nil, err
+		}
+	}
 
-	_, err := s.PG.Exec(`INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source, assigned_to, assigned_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
-		alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt, alert.Severity, alert.Source, alert.AssignedTo, alert.AssignedAt)
+	var assignedTo, teamID, policyID, parentID, windowID sql.NullString
+	var assignedAt sql.NullTime
+	var tags pq.StringArray
+	err = tx.QueryRow(`
+		INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source, assigned_to, assigned_at, escalation_policy_id, team_id, dedup_key, count, author, tags, details, parent_id, group_key, maintenance_window_id)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,1,$14,$15,$16,$17,$18,$19)
+		ON CONFLICT (dedup_key) WHERE status NOT IN ('resolved', 'closed')
+		DO UPDATE SET count = alerts.count + 1, updated_at = EXCLUDED.updated_at
+		RETURNING id, title, description, status, created_at, severity, assigned_to, assigned_at, escalation_policy_id, escalation_level, team_id, count,
+			COALESCE(author, ''), tags, details, parent_id, maintenance_window_id
+	`, alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt, alert.Severity, alert.Source,
+		alert.AssignedTo, alert.AssignedAt, nullString(alert.EscalationPolicyID), nullString(alert.TeamID), nullString(alert.DedupKey),
+		nullString(alert.Author), pq.Array(alert.Tags), string(details), nullString(alert.ParentID), nullString(alert.GroupKey),
+		nullString(alert.MaintenanceWindowID)).
+		Scan(&alert.ID, &alert.Title, &alert.Description, &alert.Status, &alert.CreatedAt, &alert.Severity, &assignedTo, &assignedAt,
+			&policyID, &alert.EscalationLevel, &teamID, &alert.Count, &alert.Author, &tags, &details, &parentID, &windowID)
 	if err != nil {
 		return nil, err
 	}
+	alert.AssignedTo, alert.EscalationPolicyID, alert.TeamID, alert.ParentID = assignedTo.String, policyID.String, teamID.String, parentID.String
+	alert.MaintenanceWindowID = windowID.String
+	alert.AssignedAt = nil
+	if assignedAt.Valid {
+		alert.AssignedAt = &assignedAt.Time
+	}
+	alert.Tags, alert.Details = append([]string{}, tags...), map[string]interface{}{}
+	if err := json.Unmarshal(details, &alert.Details); err != nil {
+		return nil, err
+	}
 
-	// Add to Redis queue for processing
-	b, _ := json.Marshal(alert)
-	s.Redis.RPush(context.Background(), "alerts:queue", b)
+	if err := s.recordCreation(tx, alert, route); err != nil {
+		return nil, err
+	}
+	// The window of a suppressed alert is over once its event repeats
+	// outside of it
+	unsuppressed := alert.Count > 1 && alert.Status == db.AlertStatusSuppressed && !suppressed
+	if unsuppressed {
+		if err := s.unsuppress(tx, alert); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// A repeated event of an open alert is already being handled, a child is
+	// handled through its parent and a suppressed alert pages nobody
+	if (alert.Count > 1 && !unsuppressed) || alert.ParentID != "" || alert.Status == db.AlertStatusSuppressed {
+		return alert, nil
+	}
 
+	s.enqueue(alert)
 	return alert, nil
 }
 
+// enqueue schedules the escalation job that pages an alert's first level
+// right away. Like every escalation job it survives restarts and is dropped
+// when the alert is acked, resolved or closed before it runs.
+func (s *AlertService) enqueue(alert *db.Alert) {
+	err := s.Scheduler.Schedule(context.Background(), ScheduledJob{
+		ID:      EscalationJobID(alert.ID),
+		Type:    JobTypeEscalation,
+		AlertID: alert.ID,
+		DueAt:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to schedule escalation for alert %s: %v", alert.ID, err)
+	}
+}
+
+// recordCreation starts the timeline of a new alert, or notes the repeated
+// event on the open alert it was folded into
+func (s *AlertService) recordCreation(ex querier, alert *db.Alert, route AlertRoute) error {
+	eventService := NewAlertEventService(s.PG, s.Redis)
+	event := userEvent(alert.ID, db.AlertEventCreated, route.UserID)
+	if route.UserID == "" && route.APIKeyID != "" {
+		event.ActorType, event.ActorID = db.ActorAPIKey, route.APIKeyID
+	}
+
+	if alert.Count > 1 {
+		event.Action = db.AlertEventDeduplicated
+		event.OldValue, event.NewValue = strconv.Itoa(alert.Count-1), strconv.Itoa(alert.Count)
+		event.Message = "repeated event for dedup key " + alert.DedupKey
+		return eventService.Record(ex, event)
+	}
+
+	event.NewValue, event.Message = alert.Status, "source "+alert.Source
+	if err := eventService.Record(ex, event); err != nil {
+		return err
+	}
+	if alert.TeamID != "" {
+		if err := eventService.Record(ex, db.AlertEvent{AlertID: alert.ID, Action: db.AlertEventRouted, NewValue: alert.TeamID}); err != nil {
+			return err
+		}
+	}
+	if alert.AssignedTo != "" {
+		if err := eventService.Record(ex, db.AlertEvent{AlertID: alert.ID, Action: db.AlertEventAssigned, NewValue: alert.AssignedTo, Message: "current on-call"}); err != nil {
+			return err
+		}
+	}
+	if alert.MaintenanceWindowID != "" {
+		if err := eventService.Record(ex, db.AlertEvent{AlertID: alert.ID, Action: db.AlertEventSuppressed, NewValue: alert.MaintenanceWindowID, Message: "maintenance window"}); err != nil {
+			return err
+		}
+	}
+	if alert.ParentID != "" {
+		if err := eventService.Record(ex, db.AlertEvent{AlertID: alert.ID, Action: db.AlertEventGrouped, NewValue: alert.ParentID, Message: "grouping rule " + groupRuleID(alert.GroupKey)}); err != nil {
+			return err
+		}
+		if err := eventService.Record(ex, db.AlertEvent{AlertID: alert.ParentID, Action: db.AlertEventChildAdded, NewValue: alert.ID, Message: alert.Title}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unsuppress turns a suppressed alert into a new one inside the creation
+// transaction
+func (s *AlertService) unsuppress(tx *sql.Tx, alert *db.Alert) error {
+	if _, err := tx.Exec(`UPDATE alerts SET status = $2, updated_at = $3 WHERE id = $1`, alert.ID, db.AlertStatusNew, time.Now()); err != nil {
+		return err
+	}
+	event := db.AlertEvent{AlertID: alert.ID, Action: db.AlertEventUnsuppressed, OldValue: alert.Status, NewValue: db.AlertStatusNew, Message: "maintenance window ended"}
+	alert.Status = db.AlertStatusNew
+	return NewAlertEventService(s.PG, s.Redis).Record(tx, event)
+}
+
+// RouteAlert picks the team of a new alert, assigns it to that team's current
+// on-call (the default on-call when no team matched) and picks its escalation
+// policy. Values the caller already set are kept.
+func (s *AlertService) RouteAlert(alert *db.Alert, route AlertRoute) error {
+	teamService := NewTeamService(s.PG, s.Redis)
+	if alert.TeamID != "" {
+		team, err := teamService.GetTeam(alert.TeamID)
+		if err != nil {
+			return err
+		}
+		if !team.IsActive {
+			return ErrTeamNotFound
+		}
+	} else {
+		teamID, err := teamService.RouteAlert(alert.Source, route.Labels, route.APIKeyID)
+		if err != nil {
+			return err
+		}
+		alert.TeamID = teamID
+	}
+
+	if alert.AssignedTo == "" {
+		userService := NewUserService(s.PG, s.Redis)
+		var onCallUser db.User
+		var err error
+		if alert.TeamID != "" {
+			onCallUser, err = userService.GetTeamOnCallUser(alert.TeamID)
+		} else {
+			onCallUser, err = userService.GetCurrentOnCallUser()
+		}
+		if err == nil {
+			alert.AssignedTo = onCallUser.ID
+			now := time.Now()
+			alert.AssignedAt = &now
+		}
+	}
+
+	if alert.EscalationPolicyID == "" {
+		policyID, err := NewEscalationService(s.PG, s.Redis).FindPolicyForAlert(alert.Source, route.ServiceID, alert.TeamID)
+		if err != nil {
+			return err
+		}
+		alert.EscalationPolicyID = policyID
+	}
+	return nil
+}
+
 func (s *AlertService) GetAlert(id string) (db.AlertResponse, error) {
+	return scanAlert(s.PG.QueryRow(alertSelect+`WHERE a.id = $1`, id))
+}
+
+func scanAlert(row rowScanner) (db.AlertResponse, error) {
 	var a db.AlertResponse
 	var assignedTo sql.NullString
 	var assignedAt sql.NullTime
+	var escalationPolicyID sql.NullString
+	var escalatedAt sql.NullTime
 	var userName sql.NullString
 	var userEmail sql.NullString
+	var tags pq.StringArray
+	var details []byte
+	var ackedAt, resolvedAt, closedAt, snoozedUntil sql.NullTime
 
-	query := `
-		SELECT 
-			a.id, a.title, a.description, a.status, a.created_at, a.updated_at, 
-			a.severity, a.source, a.assigned_to, a.assigned_at,
-			u.name, u.email
-		FROM alerts a
-		LEFT JOIN users u ON a.assigned_to = u.id
-		WHERE a.id = $1
-	`
-
-	err := s.PG.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&a.ID, &a.Title, &a.Description, &a.Status, &a.CreatedAt, &a.UpdatedAt,
-		&a.Severity, &a.Source, &assignedTo, &assignedAt,
+		&a.Severity, &a.Source, &assignedTo, &assignedAt, &a.TeamID, &a.DedupKey, &a.Count,
+		&a.Author, &tags, &details,
+		&a.AckedBy, &ackedAt, &a.ResolvedBy, &resolvedAt, &a.ClosedBy, &closedAt, &snoozedUntil,
+		&escalationPolicyID, &a.EscalationLevel, &escalatedAt,
+		&a.ParentID, &a.ChildCount, &a.MergedInto,
+		&a.MaintenanceWindowID,
 		&userName, &userEmail,
 	)
+	if err != nil {
+		return a, err
+	}
 
 	if assignedTo.Valid {
 		a.AssignedTo = assignedTo.String
@@ -151,37 +420,1002 @@ func (s *AlertService) GetAlert(id string) (db.AlertResponse, error) {
 	if assignedAt.Valid {
 		a.AssignedAt = &assignedAt.Time
 	}
+	if escalationPolicyID.Valid {
+		a.EscalationPolicyID = escalationPolicyID.String
+	}
+	if escalatedAt.Valid {
+		a.EscalatedAt = &escalatedAt.Time
+	}
 	if userName.Valid {
 		a.AssignedToName = userName.String
 	}
 	if userEmail.Valid {
 		a.AssignedToEmail = userEmail.String
 	}
+	if ackedAt.Valid {
+		a.AckedAt = &ackedAt.Time
+	}
+	if resolvedAt.Valid {
+		a.ResolvedAt = &resolvedAt.Time
+	}
+	if closedAt.Valid {
+		a.ClosedAt = &closedAt.Time
+	}
+	if snoozedUntil.Valid {
+		a.SnoozedUntil = &snoozedUntil.Time
+	}
+	a.Tags = append([]string{}, tags...)
+	a.Details = map[string]interface{}{}
+	if err := json.Unmarshal(details, &a.Details); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// Alert state transitions
+//
+// Every status change goes through transition so the alert row and its
+// in-flight escalation job always change together. Each action is only
+// allowed from the statuses it lists:
+//
+//	ack      new, escalated, snoozed, suppressed           -> acked
+//	unack    acked                                         -> new
+//	snooze   new, acked, escalated, snoozed                -> snoozed
+//	wake     snoozed (at snoozed_until)                    -> new
+//	resolve  new, acked, escalated, snoozed, suppressed    -> resolved
+//	close    any but closed                                -> closed
+//	reopen   resolved, closed                              -> new
+
+// Snoozes may not run longer than this
+const maxSnooze = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidTransition means the action is not allowed in the alert's status
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrInvalidSnooze     = errors.New("invalid snooze")
+	ErrInvalidAssignee   = errors.New("invalid assignee")
+)
+
+// AlertIsPaging reports whether responders are still being paged for an alert
+func AlertIsPaging(status string) bool {
+	return status == db.AlertStatusNew || status == db.AlertStatusEscalated
+}
+
+type escalationChange int
+
+const (
+	escalationKeep    escalationChange = iota
+	escalationCancel                   // stop paging
+	escalationRestart                  // resume paging at the current level
+	escalationReopen                   // page from the first level again
+)
+
+// statusChange is one move of the state machine: the statuses it is allowed
+// from, the UPDATE applying it ($1 is the alert ID) and what happens to the
+// alert's escalation afterwards
+type statusChange struct {
+	status     string
+	from       []string
+	event      db.AlertEvent
+	escalation escalationChange
+	query      string
+	args       []interface{}
+	cascade    bool // Also apply to the children of the alert
+}
+
+// The actor is the signed-in user making the change, empty for the system.
+// It is stored as acked_by, resolved_by or closed_by.
+func (s *AlertService) AckAlert(id, actorID string) (db.AlertActionResponse, error) {
+	return s.transition(id, ackChange(id, actorID))
+}
+
+func (s *AlertService) UnackAlert(id, actorID string) (db.AlertActionResponse, error) {
+	return s.transition(id, statusChange{
+		status:     db.AlertStatusNew,
+		from:       []string{db.AlertStatusAcked},
+		event:      userEvent(id, db.AlertEventUnacked, actorID),
+		escalation: escalationRestart,
+		query:      `UPDATE alerts SET status = 'new', acked_by = NULL, acked_at = NULL, updated_at = $2 WHERE id = $1`,
+		args:       []interface{}{time.Now()},
+	})
+}
+
+// SnoozeAlert stops paging until the duration or deadline of the request
+// passes. The alert is then reopened and its assignee notified again.
+func (s *AlertService) SnoozeAlert(id, actorID string, c *gin.Context) (db.AlertActionResponse, error) {
+	var req db.AlertSnoozeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertActionResponse{AlertID: id}, fmt.Errorf("%w: %v", ErrInvalidSnooze, err)
+	}
+	until, err := snoozeDeadline(req, time.Now())
+	if err != nil {
+		return db.AlertActionResponse{AlertID: id}, err
+	}
+
+	event := userEvent(id, db.AlertEventSnoozed, actorID)
+	event.Message = "until " + until.UTC().Format(time.RFC3339)
+	response, err := s.transition(id, statusChange{
+		status:     db.AlertStatusSnoozed,
+		from:       []string{db.AlertStatusNew, db.AlertStatusAcked, db.AlertStatusEscalated, db.AlertStatusSnoozed},
+		event:      event,
+		escalation: escalationCancel,
+		query:      `UPDATE alerts SET status = 'snoozed', snoozed_until = $2, updated_at = $3 WHERE id = $1`,
+		args:       []interface{}{until, time.Now()},
+	})
+	if err != nil {
+		return response, err
+	}
+
+	response.SnoozedUntil = &until
+	err = s.Scheduler.Schedule(context.Background(), ScheduledJob{
+		ID:      SnoozeJobID(id),
+		Type:    JobTypeSnoozeExpiry,
+		AlertID: id,
+		DueAt:   until,
+	})
+	return response, err
+}
 
-	return a, err
+// WakeAlert reopens a snoozed alert once its snooze ran out and resumes
+// escalation at the level it had reached
+func (s *AlertService) WakeAlert(id string) (db.AlertActionResponse, error) {
+	return s.transition(id, statusChange{
+		status:     db.AlertStatusNew,
+		from:       []string{db.AlertStatusSnoozed},
+		event:      db.AlertEvent{AlertID: id, Action: db.AlertEventSnoozeEnded},
+		escalation: escalationRestart,
+		query:      `UPDATE alerts SET status = 'new', snoozed_until = NULL, updated_at = $2 WHERE id = $1`,
+		args:       []interface{}{time.Now()},
+	})
 }
 
-func (s *AlertService) AckAlert(id string) error {
+func (s *AlertService) ResolveAlert(id, actorID string) (db.AlertActionResponse, error) {
+	return s.transition(id, resolveChange(id, actorID))
+}
+
+func (s *AlertService) CloseAlert(id, actorID string) (db.AlertActionResponse, error) {
+	return s.transition(id, closeChange(id, actorID))
+}
+
+// ReopenAlert puts a resolved or closed alert back to new and pages its
+// escalation policy from the first level
+func (s *AlertService) ReopenAlert(id, actorID string) (db.AlertActionResponse, error) {
+	return s.transition(id, statusChange{
+		status:     db.AlertStatusNew,
+		from:       []string{db.AlertStatusResolved, db.AlertStatusClosed},
+		event:      userEvent(id, db.AlertEventReopened, actorID),
+		escalation: escalationReopen,
+		query: `UPDATE alerts SET status = 'new', acked_by = NULL, acked_at = NULL, resolved_by = NULL, resolved_at = NULL,
+			closed_by = NULL, closed_at = NULL, escalation_level = 0, escalated_at = NULL, updated_at = $2 WHERE id = $1`,
+		args: []interface{}{time.Now()},
+	})
+}
+
+// Ack, resolve and close are shared with bulk actions
+
+func ackChange(id, actorID string) statusChange {
+	return statusChange{
+		status:     db.AlertStatusAcked,
+		from:       []string{db.AlertStatusNew, db.AlertStatusEscalated, db.AlertStatusSnoozed, db.AlertStatusSuppressed},
+		event:      userEvent(id, db.AlertEventAcked, actorID),
+		escalation: escalationCancel,
+		query:      `UPDATE alerts SET status = 'acked', acked_by = $2, acked_at = $3, snoozed_until = NULL, updated_at = $3 WHERE id = $1`,
+		args:       []interface{}{nullString(actorID), time.Now()},
+		cascade:    true,
+	}
+}
+
+func resolveChange(id, actorID string) statusChange {
+	return statusChange{
+		status:     db.AlertStatusResolved,
+		from:       []string{db.AlertStatusNew, db.AlertStatusAcked, db.AlertStatusEscalated, db.AlertStatusSnoozed, db.AlertStatusSuppressed},
+		event:      userEvent(id, db.AlertEventResolved, actorID),
+		escalation: escalationCancel,
+		query:      `UPDATE alerts SET status = 'resolved', resolved_by = $2, resolved_at = $3, snoozed_until = NULL, updated_at = $3 WHERE id = $1`,
+		args:       []interface{}{nullString(actorID), time.Now()},
+		cascade:    true,
+	}
+}
+
+func closeChange(id, actorID string) statusChange {
+	return statusChange{
+		status:     db.AlertStatusClosed,
+		from:       []string{db.AlertStatusNew, db.AlertStatusAcked, db.AlertStatusEscalated, db.AlertStatusSnoozed, db.AlertStatusSuppressed, db.AlertStatusResolved},
+		event:      userEvent(id, db.AlertEventClosed, actorID),
+		escalation: escalationCancel,
+		query:      `UPDATE alerts SET status = 'closed', closed_by = $2, closed_at = $3, snoozed_until = NULL, updated_at = $3 WHERE id = $1`,
+		args:       []interface{}{nullString(actorID), time.Now()},
+		cascade:    true,
+	}
+}
+
+// StartEscalation records the policy an alert escalates through and schedules
+// the timeout of its first level, which is returned for notification
+func (s *AlertService) StartEscalation(id, policyID string) (db.EscalationLevel, error) {
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.EscalationLevel{}, err
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	_, err := s.PG.Exec(`UPDATE alerts SET status = 'acked', acked_at = $1, updated_at = $2 WHERE id = $3`, now, now, id)
-	return err
+	_, err = tx.Exec(`UPDATE alerts SET escalation_policy_id = $1, escalation_level = 1, updated_at = $2 WHERE id = $3`,
+		nullString(policyID), now, id)
+	if err != nil {
+		return db.EscalationLevel{}, err
+	}
+	event := db.AlertEvent{AlertID: id, Action: db.AlertEventEscalationStarted, NewValue: "1", Message: "escalation policy " + policyID}
+	if policyID == "" {
+		event.Message = "no escalation policy, paging the on-call"
+	}
+	if err := NewAlertEventService(s.PG, s.Redis).Record(tx, event); err != nil {
+		return db.EscalationLevel{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return db.EscalationLevel{}, err
+	}
+
+	escalationService := NewEscalationService(s.PG, s.Redis)
+	level, err := escalationService.GetLevel(policyID, 1)
+	if err != nil {
+		return level, err
+	}
+	return level, s.ScheduleEscalation(id, level, 0)
 }
 
-func (s *AlertService) UnackAlert(id string) error {
+// EscalateAlert moves an alert to the given level and schedules that level's
+// timeout. It reports false when the alert stopped paging meanwhile.
+func (s *AlertService) EscalateAlert(id string, level db.EscalationLevel) (bool, error) {
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	_, err := s.PG.Exec(`UPDATE alerts SET status = 'new', acked_at = NULL, updated_at = $1 WHERE id = $2`, now, id)
-	return err
+	result, err := tx.Exec(`UPDATE alerts SET status = 'escalated', escalation_level = $1, escalated_at = $2, updated_at = $2 WHERE id = $3 AND status IN ('new', 'escalated')`,
+		level.LevelNumber, now, id)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+	err = NewAlertEventService(s.PG, s.Redis).Record(tx, db.AlertEvent{
+		AlertID:  id,
+		Action:   db.AlertEventEscalated,
+		OldValue: strconv.Itoa(level.LevelNumber - 1),
+		NewValue: strconv.Itoa(level.LevelNumber),
+		Message:  fmt.Sprintf("no ACK, paging %s %s", level.TargetType, level.TargetID),
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, s.ScheduleEscalation(id, level, 0)
 }
 
-func (s *AlertService) CloseAlert(id string) error {
+// ExhaustEscalation marks an alert escalated after its last level timed out
+func (s *AlertService) ExhaustEscalation(id string) error {
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	_, err := s.PG.Exec(`UPDATE alerts SET status = 'closed', updated_at = $1 WHERE id = $2`, now, id)
-	return err
+	result, err := tx.Exec(`UPDATE alerts SET status = 'escalated', escalated_at = $1, updated_at = $1 WHERE id = $2 AND status IN ('new', 'escalated')`, now, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil
+	}
+	err = NewAlertEventService(s.PG, s.Redis).Record(tx, db.AlertEvent{AlertID: id, Action: db.AlertEventEscalationExhausted, NewValue: "escalated", Message: "last escalation level timed out"})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ScheduleEscalation (re)schedules the escalation job of an alert to fire
+// when the level's delay runs out
+func (s *AlertService) ScheduleEscalation(id string, level db.EscalationLevel, attempt int) error {
+	return s.Scheduler.Schedule(context.Background(), ScheduledJob{
+		ID:      EscalationJobID(id),
+		Type:    JobTypeEscalation,
+		AlertID: id,
+		Level:   level.LevelNumber,
+		Attempt: attempt,
+		DueAt:   time.Now().Add(time.Duration(level.DelayMinutes) * time.Minute),
+	})
+}
+
+func (s *AlertService) transition(id string, change statusChange) (db.AlertActionResponse, error) {
+	response := db.AlertActionResponse{AlertID: id, Status: change.status}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return response, err
+	}
+	defer tx.Rollback()
+
+	if err := s.changeStatus(tx, id, change); err != nil {
+		return response, err
+	}
+	if err := tx.Commit(); err != nil {
+		return response, err
+	}
+	return response, s.changeEscalation(&response, change.escalation)
+}
+
+// changeStatus applies a state machine move inside the caller's transaction
+func (s *AlertService) changeStatus(tx *sql.Tx, id string, change statusChange) error {
+	event := change.event
+
+	// Lock the row so the checked status is the one being replaced
+	var mergedInto string
+	if err := tx.QueryRow(`SELECT status, COALESCE(merged_into, '') FROM alerts WHERE id = $1 FOR UPDATE`, id).Scan(&event.OldValue, &mergedInto); err != nil {
+		return err
+	}
+	if mergedInto != "" {
+		return fmt.Errorf("%w: alert is merged into %s, unmerge it first", ErrInvalidTransition, mergedInto)
+	}
+	if !slices.Contains(change.from, event.OldValue) {
+		return fmt.Errorf("%w: alert is %s, cannot move it to %s", ErrInvalidTransition, event.OldValue, change.status)
+	}
+
+	if _, err := tx.Exec(change.query, append([]interface{}{id}, change.args...)...); err != nil {
+		// Reopening while a newer alert with the same dedup key is open
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("%w: another open alert has the same dedup key", ErrInvalidTransition)
+		}
+		return err
+	}
+	event.NewValue = change.status
+	if err := NewAlertEventService(s.PG, s.Redis).Record(tx, event); err != nil {
+		return err
+	}
+	if change.cascade {
+		return s.cascadeStatus(tx, id, change)
+	}
+	return nil
+}
+
+// cascadeStatus applies the change of a parent alert to the children it is
+// allowed on, the others keep their status
+func (s *AlertService) cascadeStatus(tx *sql.Tx, parentID string, change statusChange) error {
+	rows, err := tx.Query(`SELECT id FROM alerts WHERE parent_id = $1 AND status = ANY($2) FOR UPDATE`, parentID, pq.Array(change.from))
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		child := change
+		child.cascade = false
+		child.event.AlertID, child.event.Message = id, "with parent alert "+parentID
+		if err := s.changeStatus(tx, id, child); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *AlertService) AssignAlertToUser(alertID, userID string) error {
+// changeEscalation runs once the status change is committed. If Redis fails
+// here the worker still drops the job because it re-checks the alert status
+// before paging.
+func (s *AlertService) changeEscalation(response *db.AlertActionResponse, change escalationChange) error {
+	id := response.AlertID
+	switch change {
+	case escalationCancel:
+		cancelled, err := s.Scheduler.Cancel(context.Background(), EscalationJobID(id))
+		if err != nil {
+			log.Printf("Failed to cancel escalation for alert %s: %v", id, err)
+		}
+		response.EscalationCancelled = cancelled
+
+		// A pending snooze would reopen the alert, a new snooze schedules its own
+		if _, err := s.Scheduler.Cancel(context.Background(), SnoozeJobID(id)); err != nil {
+			log.Printf("Failed to cancel snooze for alert %s: %v", id, err)
+		}
+	case escalationRestart:
+		alert, err := s.GetAlert(id)
+		if err != nil {
+			return err
+		}
+		// A child alert is paged through its parent
+		if alert.ParentID != "" {
+			break
+		}
+		levelNumber := alert.EscalationLevel
+		if levelNumber < 1 {
+			levelNumber = 1
+		}
+		level, err := NewEscalationService(s.PG, s.Redis).GetLevel(alert.EscalationPolicyID, levelNumber)
+		if err != nil {
+			log.Printf("Failed to load escalation level %d for alert %s: %v", levelNumber, id, err)
+			break
+		}
+		if err := s.ScheduleEscalation(id, level, 0); err != nil {
+			log.Printf("Failed to reschedule escalation for alert %s: %v", id, err)
+			break
+		}
+		response.EscalationScheduled = true
+	case escalationReopen:
+		alert, err := s.GetAlert(id)
+		if err != nil {
+			return err
+		}
+		if alert.ParentID != "" {
+			break
+		}
+		reopened := AlertFromResponse(alert)
+		s.enqueue(&reopened)
+		response.EscalationScheduled = true
+	}
+	return nil
+}
+
+// AssignAlert hands an alert to the user or team of the request and returns
+// the updated alert
+func (s *AlertService) AssignAlert(id, actorID string, c *gin.Context) (db.AlertResponse, error) {
+	var req db.AlertAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertResponse{}, fmt.Errorf("%w: %v", ErrInvalidAssignee, err)
+	}
+
+	var err error
+	switch {
+	case req.UserID != "" && req.TeamID != "":
+		return db.AlertResponse{}, fmt.Errorf("%w: pass either user_id or team_id", ErrInvalidAssignee)
+	case req.UserID != "":
+		err = s.AssignAlertToUser(id, req.UserID, actorID)
+	case req.TeamID != "":
+		err = s.AssignAlertToTeam(id, req.TeamID, actorID)
+	default:
+		return db.AlertResponse{}, fmt.Errorf("%w: user_id or team_id is required", ErrInvalidAssignee)
+	}
+	if err != nil {
+		return db.AlertResponse{}, err
+	}
+	return s.GetAlert(id)
+}
+
+// AssignAlertToUser hands an alert to a user and pages them
+func (s *AlertService) AssignAlertToUser(alertID, userID, actorID string) error {
+	if err := s.checkAssignee(userID); err != nil {
+		return err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.assignUser(tx, alertID, userID, actorID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return s.SchedulePage(alertID, userID, 0)
+}
+
+// AssignAlertToTeam moves an alert to a team and assigns it to the team's
+// current on-call, who is paged. Without anyone on call the alert is left
+// unassigned.
+func (s *AlertService) AssignAlertToTeam(alertID, teamID, actorID string) error {
+	team, assignee, err := s.teamAssignee(teamID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.assignTeam(tx, alertID, team, assignee, actorID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if assignee == "" {
+		return nil
+	}
+	return s.SchedulePage(alertID, assignee, 0)
+}
+
+// checkAssignee makes sure an alert can be handed to the user
+func (s *AlertService) checkAssignee(userID string) error {
+	user, err := NewUserService(s.PG, s.Redis).GetUser(userID)
+	if err != nil || !user.IsActive {
+		return fmt.Errorf("%w: user %s not found", ErrInvalidAssignee, userID)
+	}
+	return nil
+}
+
+// teamAssignee returns an active team and the user on call for it, empty
+// when nobody is
+func (s *AlertService) teamAssignee(teamID string) (db.Team, string, error) {
+	team, err := NewTeamService(s.PG, s.Redis).GetTeam(teamID)
+	if err != nil || !team.IsActive {
+		return team, "", fmt.Errorf("%w: team %s not found", ErrInvalidAssignee, teamID)
+	}
+	onCall, err := NewUserService(s.PG, s.Redis).GetTeamOnCallUser(teamID)
+	if err != nil {
+		return team, "", nil
+	}
+	return team, onCall.ID, nil
+}
+
+func (s *AlertService) assignUser(tx *sql.Tx, alertID, userID, actorID string) error {
+	event := userEvent(alertID, db.AlertEventAssigned, actorID)
+	previous, err := lockOpenAlert(tx, alertID, "assign")
+	if err != nil {
+		return err
+	}
+	event.OldValue, event.NewValue = previous.String, userID
+
 	now := time.Now()
-	_, err := s.PG.Exec(`UPDATE alerts SET assigned_to = $1, assigned_at = $2, updated_at = $3 WHERE id = $4`,
+	_, err = tx.Exec(`UPDATE alerts SET assigned_to = $1, assigned_at = $2, updated_at = $3 WHERE id = $4`,
 		userID, now, now, alertID)
-	return err
+	if err != nil {
+		return err
+	}
+	return NewAlertEventService(s.PG, s.Redis).Record(tx, event)
+}
+
+func (s *AlertService) assignTeam(tx *sql.Tx, alertID string, team db.Team, assignee, actorID string) error {
+	previous, err := lockOpenAlert(tx, alertID, "assign")
+	if err != nil {
+		return err
+	}
+	var previousTeam sql.NullString
+	if err := tx.QueryRow(`SELECT team_id FROM alerts WHERE id = $1`, alertID).Scan(&previousTeam); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE alerts SET team_id = $1, assigned_to = $2, assigned_at = $3, updated_at = $3 WHERE id = $4`,
+		team.ID, nullString(assignee), now, alertID)
+	if err != nil {
+		return err
+	}
+
+	eventService := NewAlertEventService(s.PG, s.Redis)
+	routed := userEvent(alertID, db.AlertEventRouted, actorID)
+	routed.OldValue, routed.NewValue = previousTeam.String, team.ID
+	if err := eventService.Record(tx, routed); err != nil {
+		return err
+	}
+	assigned := userEvent(alertID, db.AlertEventAssigned, actorID)
+	assigned.OldValue, assigned.NewValue, assigned.Message = previous.String, assignee, "on-call of team "+team.Name
+	if assignee == "" {
+		assigned.Message = "team " + team.Name + " has nobody on call"
+	}
+	return eventService.Record(tx, assigned)
+}
+
+// EscalateNow moves an alert to the next level of its escalation policy
+// without waiting for the current level's delay, and pages that level. A
+// grouped child cannot be escalated, its parent pages for it.
+func (s *AlertService) EscalateNow(id, actorID string) (db.AlertActionResponse, error) {
+	response := db.AlertActionResponse{AlertID: id, Status: db.AlertStatusEscalated}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return response, err
+	}
+	defer tx.Rollback()
+
+	var status, parentID string
+	var policyID sql.NullString
+	var current int
+	err = tx.QueryRow(`SELECT status, escalation_policy_id, escalation_level, COALESCE(parent_id, '') FROM alerts WHERE id = $1 FOR UPDATE`, id).
+		Scan(&status, &policyID, &current, &parentID)
+	if err != nil {
+		return response, err
+	}
+	// Only the parent of a group pages
+	if parentID != "" {
+		return response, fmt.Errorf("%w: alert is grouped under %s, escalate the parent alert", ErrInvalidTransition, parentID)
+	}
+	if !slices.Contains([]string{db.AlertStatusNew, db.AlertStatusAcked, db.AlertStatusEscalated}, status) {
+		return response, fmt.Errorf("%w: alert is %s, cannot escalate it", ErrInvalidTransition, status)
+	}
+	if current < 1 {
+		current = 1
+	}
+
+	next, err := NewEscalationService(s.PG, s.Redis).GetLevel(policyID.String, current+1)
+	if err == sql.ErrNoRows {
+		return response, fmt.Errorf("%w: level %d is the last escalation level", ErrInvalidTransition, current)
+	} else if err != nil {
+		return response, err
+	}
+
+	// Escalating an acked alert takes the ack back, the next level is paged
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE alerts SET status = 'escalated', acked_by = NULL, acked_at = NULL, escalation_level = $2, escalated_at = $3, updated_at = $3 WHERE id = $1`,
+		id, next.LevelNumber, now)
+	if err != nil {
+		return response, err
+	}
+	event := userEvent(id, db.AlertEventEscalated, actorID)
+	event.OldValue, event.NewValue = strconv.Itoa(current), strconv.Itoa(next.LevelNumber)
+	event.Message = fmt.Sprintf("escalated by hand, paging %s %s", next.TargetType, next.TargetID)
+	if err := NewAlertEventService(s.PG, s.Redis).Record(tx, event); err != nil {
+		return response, err
+	}
+	if err := tx.Commit(); err != nil {
+		return response, err
+	}
+
+	if err := s.ScheduleEscalation(id, next, 0); err != nil {
+		return response, err
+	}
+	response.EscalationScheduled = true
+	return response, s.SchedulePage(id, "", next.LevelNumber)
+}
+
+// ListResponders returns the users added to an alert, oldest first
+func (s *AlertService) ListResponders(id string) ([]db.AlertResponder, error) {
+	rows, err := s.PG.Query(`
+		SELECT r.alert_id, r.user_id, COALESCE(u.name, ''), COALESCE(r.added_by, ''), r.created_at
+		FROM alert_responders r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.alert_id = $1
+		ORDER BY r.created_at
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	responders := []db.AlertResponder{}
+	for rows.Next() {
+		var r db.AlertResponder
+		if err := rows.Scan(&r.AlertID, &r.UserID, &r.UserName, &r.AddedBy, &r.CreatedAt); err != nil {
+			continue
+		}
+		responders = append(responders, r)
+	}
+	return responders, nil
+}
+
+// AddResponders pages additional users on an alert. Users already added are
+// skipped, they are not paged twice.
+func (s *AlertService) AddResponders(id, actorID string, c *gin.Context) ([]db.AlertResponder, error) {
+	var req db.AlertRespondersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssignee, err)
+	}
+	userService := NewUserService(s.PG, s.Redis)
+	for _, userID := range req.UserIDs {
+		if user, err := userService.GetUser(userID); err != nil || !user.IsActive {
+			return nil, fmt.Errorf("%w: user %s not found", ErrInvalidAssignee, userID)
+		}
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOpenAlert(tx, id, "add responders to"); err != nil {
+		return nil, err
+	}
+
+	eventService := NewAlertEventService(s.PG, s.Redis)
+	var added []string
+	for _, userID := range req.UserIDs {
+		result, err := tx.Exec(`INSERT INTO alert_responders (alert_id, user_id, added_by, created_at) VALUES ($1,$2,$3,$4) ON CONFLICT DO NOTHING`,
+			id, userID, nullString(actorID), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			continue
+		}
+		event := userEvent(id, db.AlertEventResponderAdded, actorID)
+		event.NewValue = userID
+		if err := eventService.Record(tx, event); err != nil {
+			return nil, err
+		}
+		added = append(added, userID)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range added {
+		if err := s.SchedulePage(id, userID, 0); err != nil {
+			return nil, err
+		}
+	}
+	return s.ListResponders(id)
+}
+
+// SchedulePage hands a page to the worker: the user, or the targets of the
+// level when userID is empty. Level 0 pages the user at the alert's current
+// escalation level.
+func (s *AlertService) SchedulePage(id, userID string, level int) error {
+	return s.Scheduler.Schedule(context.Background(), ScheduledJob{
+		ID:      PageJobID(id, userID, level),
+		Type:    JobTypePage,
+		AlertID: id,
+		UserID:  userID,
+		Level:   level,
+		DueAt:   time.Now(),
+	})
+}
+
+// lockOpenAlert locks an alert for a change of who handles it and returns
+// its assignee. Resolved and closed alerts are left alone.
+func lockOpenAlert(tx *sql.Tx, id, action string) (sql.NullString, error) {
+	var status string
+	var assignedTo sql.NullString
+	if err := tx.QueryRow(`SELECT status, assigned_to FROM alerts WHERE id = $1 FOR UPDATE`, id).Scan(&status, &assignedTo); err != nil {
+		return assignedTo, err
+	}
+	if status == db.AlertStatusResolved || status == db.AlertStatusClosed {
+		return assignedTo, fmt.Errorf("%w: alert is %s, cannot %s it", ErrInvalidTransition, status, action)
+	}
+	return assignedTo, nil
+}
+
+// snoozeDeadline returns when a snooze requested at now ends
+func snoozeDeadline(req db.AlertSnoozeRequest, now time.Time) (time.Time, error) {
+	var until time.Time
+	switch {
+	case req.Duration != "" && req.Until != nil:
+		return until, fmt.Errorf("%w: pass either duration or until", ErrInvalidSnooze)
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return until, fmt.Errorf("%w: duration %q, expected e.g. 30m or 2h", ErrInvalidSnooze, req.Duration)
+		}
+		until = now.Add(d)
+	case req.Until != nil:
+		until = *req.Until
+	default:
+		return until, fmt.Errorf("%w: duration or until is required", ErrInvalidSnooze)
+	}
+
+	if !until.After(now) {
+		return until, fmt.Errorf("%w: the snooze must end in the future", ErrInvalidSnooze)
+	}
+	if until.Sub(now) > maxSnooze {
+		return until, fmt.Errorf("%w: snoozes are limited to 7 days", ErrInvalidSnooze)
+	}
+	return until.UTC(), nil
+}
+
+// alertFilterWhere builds the WHERE clause of ListAlerts
+func alertFilterWhere(filter AlertFilter) (string, []interface{}) {
+	conditions := []string{"true"}
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(filter.Statuses) > 0 {
+		add("a.status = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if len(filter.Severities) > 0 {
+		add("a.severity = ANY($%d)", pq.Array(filter.Severities))
+	}
+	if len(filter.Sources) > 0 {
+		add("a.source = ANY($%d)", pq.Array(filter.Sources))
+	}
+	if filter.AssignedTo != "" {
+		add("a.assigned_to = $%d", filter.AssignedTo)
+	}
+	if filter.TeamID != "" {
+		add("a.team_id = $%d", filter.TeamID)
+	}
+	if tags := normalizeTags(filter.Tags); len(tags) > 0 {
+		add("a.tags @> $%d", pq.Array(tags))
+	}
+	if filter.From != nil {
+		add("a.created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("a.created_at < $%d", *filter.To)
+	}
+	if filter.Search != "" {
+		// Same expression as idx_alerts_search
+		add("to_tsvector('simple', a.title || ' ' || COALESCE(a.description, '')) @@ websearch_to_tsquery('simple', $%d)", filter.Search)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// Alert cursors are the created_at and ID of the last alert of a page
+
+func encodeAlertCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeAlertCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t, id, nil
+}
+
+// Alert tags and details
+
+// SetTags replaces the tags of an alert
+func (s *AlertService) SetTags(id, actorID string, c *gin.Context) ([]string, error) {
+	var req db.AlertTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	return s.updateTags(id, actorID, func([]string) []string { return req.Tags })
+}
+
+// AddTags adds tags to the ones an alert already carries
+func (s *AlertService) AddTags(id, actorID string, c *gin.Context) ([]string, error) {
+	var req db.AlertTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	return s.updateTags(id, actorID, func(current []string) []string { return append(current, req.Tags...) })
+}
+
+func (s *AlertService) RemoveTag(id, tag, actorID string) ([]string, error) {
+	removed := normalizeTags([]string{tag})
+	return s.updateTags(id, actorID, func(current []string) []string {
+		kept := []string{}
+		for _, t := range current {
+			if len(removed) == 0 || t != removed[0] {
+				kept = append(kept, t)
+			}
+		}
+		return kept
+	})
+}
+
+// UpdateDetails merges the request body into an alert's details. A null
+// value removes the key.
+func (s *AlertService) UpdateDetails(id, actorID string, c *gin.Context) (map[string]interface{}, error) {
+	var changes map[string]interface{}
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		return nil, err
+	}
+	return s.MergeDetails(id, actorID, changes)
+}
+
+func (s *AlertService) MergeDetails(id, actorID string, changes map[string]interface{}) (map[string]interface{}, error) {
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var raw []byte
+	if err := tx.QueryRow(`SELECT details FROM alerts WHERE id = $1 FOR UPDATE`, id).Scan(&raw); err != nil {
+		return nil, err
+	}
+	details := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &details); err != nil {
+		return nil, err
+	}
+
+	previous := map[string]interface{}{}
+	for key, value := range changes {
+		if old, ok := details[key]; ok {
+			previous[key] = old
+		}
+		if value == nil {
+			delete(details, key)
+		} else {
+			details[key] = value
+		}
+	}
+
+	raw, err = json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE alerts SET details = $2, updated_at = $3 WHERE id = $1`, id, string(raw), time.Now()); err != nil {
+		return nil, err
+	}
+
+	event := userEvent(id, db.AlertEventDetailsChanged, actorID)
+	oldValue, _ := json.Marshal(previous)
+	newValue, _ := json.Marshal(changes)
+	event.OldValue, event.NewValue = string(oldValue), string(newValue)
+	if err := NewAlertEventService(s.PG, s.Redis).Record(tx, event); err != nil {
+		return nil, err
+	}
+	return details, tx.Commit()
+}
+
+func (s *AlertService) updateTags(id, actorID string, change func([]string) []string) ([]string, error) {
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tags, err := s.changeTags(tx, id, actorID, change)
+	if err != nil {
+		return nil, err
+	}
+	return tags, tx.Commit()
+}
+
+func (s *AlertService) changeTags(tx *sql.Tx, id, actorID string, change func([]string) []string) ([]string, error) {
+	var current pq.StringArray
+	if err := tx.QueryRow(`SELECT tags FROM alerts WHERE id = $1 FOR UPDATE`, id).Scan(&current); err != nil {
+		return nil, err
+	}
+	tags := normalizeTags(change(append([]string{}, current...)))
+	if strings.Join(tags, ",") == strings.Join(current, ",") {
+		return tags, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE alerts SET tags = $2, updated_at = $3 WHERE id = $1`, id, pq.Array(tags), time.Now()); err != nil {
+		return nil, err
+	}
+
+	event := userEvent(id, db.AlertEventTagsChanged, actorID)
+	event.OldValue, event.NewValue = strings.Join(current, ","), strings.Join(tags, ",")
+	if err := NewAlertEventService(s.PG, s.Redis).Record(tx, event); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// normalizeTags trims and lower-cases tags, dropping empty and repeated ones
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// nullString maps an empty string to SQL NULL for optional reference columns
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
 }
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// Bulk actions change at most this many alerts per request
+const maxBulkAlerts = 1000
+
+// ErrInvalidBulk means a bulk request has no alerts to act on, too many, or
+// lacks what its action needs
+var ErrInvalidBulk = errors.New("invalid bulk request")
+
+// bulkStep changes one alert inside the bulk transaction, done runs for it
+// once the transaction is committed
+type bulkStep struct {
+	apply func(tx *sql.Tx, id string) error
+	done  func(result *db.AlertBulkResult)
+}
+
+// BulkAction applies one action to the alerts listed in the request, or to
+// the alerts matching the filter when it lists none, in a single
+// transaction. An alert the action does not apply to is reported in its
+// result and left unchanged; the other alerts are still changed. Ack,
+// resolve and close cancel the escalation of every alert they change.
+func (s *AlertService) BulkAction(filter AlertFilter, actorID string, c *gin.Context) (db.AlertBulkResponse, error) {
+	var req db.AlertBulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertBulkResponse{}, fmt.Errorf("%w: %v", ErrInvalidBulk, err)
+	}
+	response := db.AlertBulkResponse{Action: req.Action, Results: []db.AlertBulkResult{}}
+
+	step, err := s.bulkStep(req, actorID)
+	if err != nil {
+		return response, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return response, err
+	}
+	defer tx.Rollback()
+
+	ids, err := bulkAlertIDs(tx, req.IDs, filter)
+	if err != nil {
+		return response, err
+	}
+	response.Matched = len(ids)
+
+	// A savepoint per alert keeps one failed change from aborting the others
+	for _, id := range ids {
+		result := db.AlertBulkResult{AlertID: id}
+		if _, err := tx.Exec(`SAVEPOINT bulk_alert`); err != nil {
+			return response, err
+		}
+		if err := step.apply(tx, id); err != nil {
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT bulk_alert`); err != nil {
+				return response, err
+			}
+			result.Error = bulkError(id, err)
+		} else {
+			if _, err := tx.Exec(`RELEASE SAVEPOINT bulk_alert`); err != nil {
+				return response, err
+			}
+			result.OK = true
+		}
+		response.Results = append(response.Results, result)
+	}
+	if err := tx.Commit(); err != nil {
+		return response, err
+	}
+
+	for i := range response.Results {
+		result := &response.Results[i]
+		if !result.OK {
+			response.Failed++
+			continue
+		}
+		response.Succeeded++
+		if step.done != nil {
+			step.done(result)
+		}
+	}
+	return response, nil
+}
+
+// bulkStep picks what a bulk request does to each alert. Users and teams
+// are checked once up front, not per alert.
+func (s *AlertService) bulkStep(req db.AlertBulkRequest, actorID string) (bulkStep, error) {
+	switch req.Action {
+	case db.AlertBulkAck, db.AlertBulkResolve, db.AlertBulkClose:
+		change := map[string]func(id, actorID string) statusChange{
+			db.AlertBulkAck:     ackChange,
+			db.AlertBulkResolve: resolveChange,
+			db.AlertBulkClose:   closeChange,
+		}[req.Action]
+		status := change("", actorID).status
+		return bulkStep{
+			apply: func(tx *sql.Tx, id string) error {
+				return s.changeStatus(tx, id, change(id, actorID))
+			},
+			done: func(result *db.AlertBulkResult) {
+				response := db.AlertActionResponse{AlertID: result.AlertID}
+				if err := s.changeEscalation(&response, escalationCancel); err != nil {
+					log.Printf("Failed to cancel escalation for alert %s: %v", result.AlertID, err)
+				}
+				result.Status, result.EscalationCancelled = status, response.EscalationCancelled
+			},
+		}, nil
+
+	case db.AlertBulkAssign:
+		switch {
+		case req.UserID != "" && req.TeamID != "":
+			return bulkStep{}, fmt.Errorf("%w: pass either user_id or team_id", ErrInvalidBulk)
+		case req.UserID != "":
+			if err := s.checkAssignee(req.UserID); err != nil {
+				return bulkStep{}, err
+			}
+			return bulkStep{
+				apply: func(tx *sql.Tx, id string) error { return s.assignUser(tx, id, req.UserID, actorID) },
+				done:  func(result *db.AlertBulkResult) { s.bulkPage(result.AlertID, req.UserID) },
+			}, nil
+		case req.TeamID != "":
+			team, assignee, err := s.teamAssignee(req.TeamID)
+			if err != nil {
+				return bulkStep{}, err
+			}
+			return bulkStep{
+				apply: func(tx *sql.Tx, id string) error { return s.assignTeam(tx, id, team, assignee, actorID) },
+				done:  func(result *db.AlertBulkResult) { s.bulkPage(result.AlertID, assignee) },
+			}, nil
+		default:
+			return bulkStep{}, fmt.Errorf("%w: assign needs user_id or team_id", ErrInvalidBulk)
+		}
+
+	case db.AlertBulkTag:
+		if len(normalizeTags(req.Tags)) == 0 {
+			return bulkStep{}, fmt.Errorf("%w: tag needs tags", ErrInvalidBulk)
+		}
+		return bulkStep{
+			apply: func(tx *sql.Tx, id string) error {
+				_, err := s.changeTags(tx, id, actorID, func(current []string) []string { return append(current, req.Tags...) })
+				return err
+			},
+		}, nil
+	}
+	return bulkStep{}, fmt.Errorf("%w: unknown action %s", ErrInvalidBulk, req.Action)
+}
+
+// bulkPage pages the new assignee of an alert changed by a bulk assign
+func (s *AlertService) bulkPage(alertID, userID string) {
+	if userID == "" {
+		return
+	}
+	if err := s.SchedulePage(alertID, userID, 0); err != nil {
+		log.Printf("Failed to page %s on alert %s: %v", userID, alertID, err)
+	}
+}
+
+// bulkAlertIDs returns the IDs of the request without repeats, or the newest
+// alerts matching the filter when it lists none
+func bulkAlertIDs(tx *sql.Tx, ids []string, filter AlertFilter) ([]string, error) {
+	if len(ids) > 0 {
+		unique := []string{}
+		for _, id := range ids {
+			if !slices.Contains(unique, id) {
+				unique = append(unique, id)
+			}
+		}
+		if len(unique) > maxBulkAlerts {
+			return nil, fmt.Errorf("%w: at most %d alerts per request", ErrInvalidBulk, maxBulkAlerts)
+		}
+		return unique, nil
+	}
+
+	where, args := alertFilterWhere(filter)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: ids or a filter is required", ErrInvalidBulk)
+	}
+	args = append(args, maxBulkAlerts+1)
+	rows, err := tx.Query(`SELECT a.id FROM alerts a WHERE `+where+fmt.Sprintf(` ORDER BY a.created_at DESC, a.id DESC LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matched := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		matched = append(matched, id)
+	}
+	if len(matched) > maxBulkAlerts {
+		return nil, fmt.Errorf("%w: the filter matches more than %d alerts, narrow it down", ErrInvalidBulk, maxBulkAlerts)
+	}
+	return matched, rows.Err()
+}
+
+// bulkError is the error reported for one alert of a bulk action
+func bulkError(id string, err error) string {
+	switch {
+	case err == sql.ErrNoRows:
+		return "not found"
+	case errors.Is(err, ErrInvalidTransition):
+		return err.Error()
+	default:
+		log.Printf("Bulk action failed for alert %s: %v", id, err)
+		return "db error"
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+type AlertEventService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewAlertEventService(pg *sql.DB, redis *redis.Client) *AlertEventService {
+	return &AlertEventService{PG: pg, Redis: redis}
+}
+
+// ListEvents returns the timeline of an alert and of the alerts merged into
+// it, oldest first
+func (s *AlertEventService) ListEvents(alertID string) ([]db.AlertEvent, error) {
+	rows, err := s.PG.Query(`
+		SELECT e.id, e.alert_id, e.action, e.actor_type, COALESCE(e.actor_id, ''), COALESCE(u.name, ''),
+			COALESCE(e.old_value, ''), COALESCE(e.new_value, ''), COALESCE(e.message, ''), e.created_at
+		FROM alert_events e
+		LEFT JOIN users u ON e.actor_type = 'user' AND u.id = e.actor_id
+		WHERE e.alert_id = $1 OR e.alert_id IN (SELECT id FROM alerts WHERE merged_into = $1)
+		ORDER BY e.created_at, e.id
+	`, alertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []db.AlertEvent{}
+	for rows.Next() {
+		var e db.AlertEvent
+		err := rows.Scan(&e.ID, &e.AlertID, &e.Action, &e.ActorType, &e.ActorID, &e.ActorName, &e.OldValue, &e.NewValue, &e.Message, &e.CreatedAt)
+		if err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	execer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Record appends an event to an alert's timeline and publishes it to the
+// alert stream. Pass the transaction of the change being recorded so both
+// are stored together.
+func (s *AlertEventService) Record(ex querier, event db.AlertEvent) error {
+	event.ID = uuid.New().String()
+	event.CreatedAt = time.Now()
+	if event.ActorType == "" {
+		event.ActorType = db.ActorSystem
+	}
+
+	_, err := ex.Exec(`INSERT INTO alert_events (id, alert_id, action, actor_type, actor_id, old_value, new_value, message, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		event.ID, event.AlertID, event.Action, event.ActorType, nullString(event.ActorID), nullString(event.OldValue), nullString(event.NewValue), nullString(event.Message), event.CreatedAt)
+	if err != nil {
+		return err
+	}
+	publishAlertEvent(s.Redis, ex, event)
+	return nil
+}
+
+// userEvent attributes an event to a user, or to the system when the change
+// was not made by a signed-in user
+func userEvent(alertID, action, actorID string) db.AlertEvent {
+	event := db.AlertEvent{AlertID: alertID, Action: action, ActorType: db.ActorSystem}
+	if actorID != "" {
+		event.ActorType, event.ActorID = db.ActorUser, actorID
+	}
+	return event
+}
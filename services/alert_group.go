@@ -0,0 +1,225 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+var ErrAlertGroupRuleNotFound = errors.New("alert group rule not found")
+
+type AlertGroupService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewAlertGroupService(pg *sql.DB, redis *redis.Client) *AlertGroupService {
+	return &AlertGroupService{PG: pg, Redis: redis}
+}
+
+const alertGroupRuleSelect = `
+	SELECT id, name, source, group_by, label, window_minutes, is_active, created_at, updated_at
+	FROM alert_group_rules
+`
+
+// Rules naming a source come first
+const alertGroupRuleOrder = ` ORDER BY source = '', created_at`
+
+// Group rule CRUD operations
+func (s *AlertGroupService) ListRules() ([]db.AlertGroupRule, error) {
+	return s.queryRules(alertGroupRuleSelect + `WHERE is_active = true` + alertGroupRuleOrder)
+}
+
+func (s *AlertGroupService) GetRule(id string) (db.AlertGroupRule, error) {
+	rules, err := s.queryRules(alertGroupRuleSelect+`WHERE id = $1`, id)
+	if err != nil {
+		return db.AlertGroupRule{}, err
+	}
+	if len(rules) == 0 {
+		return db.AlertGroupRule{}, ErrAlertGroupRuleNotFound
+	}
+	return rules[0], nil
+}
+
+func (s *AlertGroupService) CreateRule(c *gin.Context) (db.AlertGroupRule, error) {
+	var req db.AlertGroupRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertGroupRule{}, err
+	}
+	if err := validateAlertGroupRule(&req); err != nil {
+		return db.AlertGroupRule{}, err
+	}
+
+	rule := db.AlertGroupRule{
+		ID:            uuid.New().String(),
+		Name:          req.Name,
+		Source:        req.Source,
+		GroupBy:       req.GroupBy,
+		Label:         req.Label,
+		WindowMinutes: req.WindowMinutes,
+		IsActive:      true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO alert_group_rules (id, name, source, group_by, label, window_minutes, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		rule.ID, rule.Name, rule.Source, rule.GroupBy, rule.Label, rule.WindowMinutes, rule.IsActive, rule.CreatedAt, rule.UpdatedAt)
+	return rule, err
+}
+
+func (s *AlertGroupService) UpdateRule(id string, c *gin.Context) (db.AlertGroupRule, error) {
+	var req db.AlertGroupRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertGroupRule{}, err
+	}
+	if err := validateAlertGroupRule(&req); err != nil {
+		return db.AlertGroupRule{}, err
+	}
+
+	result, err := s.PG.Exec(`UPDATE alert_group_rules SET name=$2, source=$3, group_by=$4, label=$5, window_minutes=$6, updated_at=$7 WHERE id=$1 AND is_active = true`,
+		id, req.Name, req.Source, req.GroupBy, req.Label, req.WindowMinutes, time.Now())
+	if err != nil {
+		return db.AlertGroupRule{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return db.AlertGroupRule{}, ErrAlertGroupRuleNotFound
+	}
+	return s.GetRule(id)
+}
+
+func (s *AlertGroupService) DeleteRule(id string) error {
+	_, err := s.PG.Exec(`UPDATE alert_group_rules SET is_active = false, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// GroupKey picks the group key of a new alert from the first rule giving
+// one, and the oldest creation time of a parent it may join
+func (s *AlertGroupService) GroupKey(alert *db.Alert, route AlertRoute) (string, time.Time, error) {
+	rules, err := s.queryRules(alertGroupRuleSelect+`WHERE is_active = true AND source IN ('', $1)`+alertGroupRuleOrder, alert.Source)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	for _, rule := range rules {
+		value, ok := groupValue(rule, alert, route)
+		if !ok {
+			continue
+		}
+		var since time.Time
+		if rule.WindowMinutes > 0 {
+			since = time.Now().Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+		}
+		return rule.ID + ":" + value, since, nil
+	}
+	return "", time.Time{}, nil
+}
+
+// ListChildren returns the alerts grouped under an alert, oldest first
+func (s *AlertGroupService) ListChildren(parentID string) ([]db.AlertResponse, error) {
+	if _, err := NewAlertService(s.PG, s.Redis).GetAlert(parentID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.PG.Query(alertSelect+`WHERE a.parent_id = $1 ORDER BY a.created_at, a.id`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := []db.AlertResponse{}
+	for rows.Next() {
+		child, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, rows.Err()
+}
+
+// Helper functions
+
+// groupParent finds the open parent alert of a group key, holding a lock on
+// the key until the transaction ends so that two alerts of a new group do
+// not both become parents
+func groupParent(tx *sql.Tx, groupKey string, since time.Time) (string, error) {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, groupKey); err != nil {
+		return "", err
+	}
+
+	var parentID string
+	err := tx.QueryRow(`
+		SELECT id FROM alerts
+		WHERE group_key = $1 AND parent_id IS NULL AND status NOT IN ('resolved', 'closed') AND created_at >= $2
+		ORDER BY created_at LIMIT 1
+	`, groupKey, since).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return parentID, err
+}
+
+// groupValue is what a rule groups an alert by, if the alert has it
+func groupValue(rule db.AlertGroupRule, alert *db.Alert, route AlertRoute) (string, bool) {
+	switch rule.GroupBy {
+	case db.AlertGroupByLabel:
+		value, ok := route.Labels[rule.Label]
+		return value, ok && value != ""
+	case db.AlertGroupByService:
+		if route.ServiceID != "" {
+			return route.ServiceID, true
+		}
+		value, ok := route.Labels["service"]
+		return value, ok && value != ""
+	case db.AlertGroupBySource:
+		return alert.Source, true
+	case db.AlertGroupByAlertManagerGroup:
+		return route.GroupKey, route.GroupKey != ""
+	case db.AlertGroupByTime:
+		return "", true
+	}
+	return "", false
+}
+
+// groupRuleID is the rule a group key was made by
+func groupRuleID(groupKey string) string {
+	ruleID, _, _ := strings.Cut(groupKey, ":")
+	return ruleID
+}
+
+func validateAlertGroupRule(req *db.AlertGroupRuleRequest) error {
+	if req.GroupBy == db.AlertGroupByLabel && req.Label == "" {
+		return errors.New("label is required to group by label")
+	}
+	if req.GroupBy == db.AlertGroupByTime && req.WindowMinutes <= 0 {
+		return errors.New("window_minutes is required to group by time")
+	}
+	if req.GroupBy != db.AlertGroupByLabel {
+		req.Label = ""
+	}
+	return nil
+}
+
+func (s *AlertGroupService) queryRules(query string, args ...interface{}) ([]db.AlertGroupRule, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []db.AlertGroupRule{}
+	for rows.Next() {
+		var r db.AlertGroupRule
+		if err := rows.Scan(&r.ID, &r.Name, &r.Source, &r.GroupBy, &r.Label, &r.WindowMinutes, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// ErrInvalidMerge means a merge request lists no alerts or the target itself
+var ErrInvalidMerge = errors.New("invalid merge request")
+
+// MergeAlerts folds the alerts of the request into the target alert in one
+// transaction. Each merged alert is closed and stops paging; its count and
+// tags are added to the target, whose notes and timeline include those of
+// its merged alerts. It returns the target.
+func (s *AlertService) MergeAlerts(targetID, actorID string, c *gin.Context) (db.AlertResponse, error) {
+	ids, err := mergeAlertIDs(targetID, c)
+	if err != nil {
+		return db.AlertResponse{}, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.AlertResponse{}, err
+	}
+	defer tx.Rollback()
+
+	var mergedInto string
+	if err := tx.QueryRow(`SELECT COALESCE(merged_into, '') FROM alerts WHERE id = $1 FOR UPDATE`, targetID).Scan(&mergedInto); err != nil {
+		return db.AlertResponse{}, err
+	}
+	if mergedInto != "" {
+		return db.AlertResponse{}, fmt.Errorf("%w: alert is merged into %s, merge into that alert instead", ErrInvalidTransition, mergedInto)
+	}
+	for _, id := range ids {
+		if err := s.mergeAlert(tx, targetID, id, actorID); err != nil {
+			return db.AlertResponse{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return db.AlertResponse{}, err
+	}
+
+	for _, id := range ids {
+		if err := s.changeEscalation(&db.AlertActionResponse{AlertID: id}, escalationCancel); err != nil {
+			log.Printf("Failed to cancel escalation for merged alert %s: %v", id, err)
+		}
+	}
+	return s.GetAlertWithMerged(targetID)
+}
+
+// UnmergeAlerts splits merged alerts back out of their target. Each gets
+// back the status it had before the merge, except that an alert which was
+// still paging is reopened as new and paged again. Its count and the tags
+// it brought are taken off the target. It returns the target.
+func (s *AlertService) UnmergeAlerts(targetID, actorID string, c *gin.Context) (db.AlertResponse, error) {
+	ids, err := mergeAlertIDs(targetID, c)
+	if err != nil {
+		return db.AlertResponse{}, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.AlertResponse{}, err
+	}
+	defer tx.Rollback()
+
+	var reopened []string
+	for _, id := range ids {
+		status, err := s.unmergeAlert(tx, targetID, id, actorID)
+		if err != nil {
+			return db.AlertResponse{}, err
+		}
+		if status == db.AlertStatusNew {
+			reopened = append(reopened, id)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return db.AlertResponse{}, err
+	}
+
+	for _, id := range reopened {
+		if err := s.changeEscalation(&db.AlertActionResponse{AlertID: id}, escalationReopen); err != nil {
+			log.Printf("Failed to page unmerged alert %s: %v", id, err)
+		}
+	}
+	return s.GetAlertWithMerged(targetID)
+}
+
+// GetAlertWithMerged returns an alert with the alerts merged into it
+func (s *AlertService) GetAlertWithMerged(id string) (db.AlertResponse, error) {
+	alert, err := s.GetAlert(id)
+	if err != nil {
+		return alert, err
+	}
+
+	rows, err := s.PG.Query(`SELECT id, title, COALESCE(merged_status, ''), count, merged_at FROM alerts WHERE merged_into = $1 ORDER BY merged_at, id`, id)
+	if err != nil {
+		return alert, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m db.MergedAlert
+		if err := rows.Scan(&m.ID, &m.Title, &m.Status, &m.Count, &m.MergedAt); err != nil {
+			return alert, err
+		}
+		alert.MergedAlerts = append(alert.MergedAlerts, m)
+	}
+	return alert, rows.Err()
+}
+
+// Helper functions
+
+// mergeAlert closes one alert into the target inside the merge transaction
+func (s *AlertService) mergeAlert(tx *sql.Tx, targetID, id, actorID string) error {
+	var status, mergedInto string
+	var count int
+	var tags pq.StringArray
+	var hasMerged, hasChildren bool
+	err := tx.QueryRow(`
+		SELECT status, COALESCE(merged_into, ''), count, tags,
+			EXISTS (SELECT 1 FROM alerts m WHERE m.merged_into = a.id),
+			EXISTS (SELECT 1 FROM alerts c WHERE c.parent_id = a.id AND c.status NOT IN ('resolved', 'closed'))
+		FROM alerts a WHERE id = $1 FOR UPDATE
+	`, id).Scan(&status, &mergedInto, &count, &tags, &hasMerged, &hasChildren)
+	if err != nil {
+		return err
+	}
+	switch {
+	case mergedInto != "":
+		return fmt.Errorf("%w: alert %s is already merged into %s", ErrInvalidTransition, id, mergedInto)
+	case hasMerged:
+		return fmt.Errorf("%w: alert %s has merged alerts of its own, unmerge them first", ErrInvalidTransition, id)
+	case hasChildren:
+		return fmt.Errorf("%w: alert %s has open grouped alerts", ErrInvalidTransition, id)
+	}
+
+	// The tags the target did not have yet go back with an unmerge
+	var added []string
+	_, err = s.changeTags(tx, targetID, actorID, func(current []string) []string {
+		for _, tag := range tags {
+			if !slices.Contains(current, tag) {
+				added = append(added, tag)
+			}
+		}
+		return append(current, added...)
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE alerts SET merged_into = $2, merged_at = $3, merged_status = status, merged_tags = $4, status = 'closed',
+			closed_by = CASE WHEN status = 'closed' THEN closed_by ELSE $5 END,
+			closed_at = CASE WHEN status = 'closed' THEN closed_at ELSE $3 END,
+			snoozed_until = NULL, updated_at = $3
+		WHERE id = $1
+	`, id, targetID, now, pq.Array(added), nullString(actorID))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE alerts SET count = count + $2, updated_at = $3 WHERE id = $1`, targetID, count, now); err != nil {
+		return err
+	}
+
+	eventService := NewAlertEventService(s.PG, s.Redis)
+	event := userEvent(id, db.AlertEventMerged, actorID)
+	event.OldValue, event.NewValue, event.Message = status, targetID, "merged into alert "+targetID
+	if err := eventService.Record(tx, event); err != nil {
+		return err
+	}
+	event = userEvent(targetID, db.AlertEventMergeAdded, actorID)
+	event.NewValue, event.Message = id, "count +"+strconv.Itoa(count)
+	return eventService.Record(tx, event)
+}
+
+// unmergeAlert splits one alert out of the target inside the unmerge
+// transaction and returns its new status
+func (s *AlertService) unmergeAlert(tx *sql.Tx, targetID, id, actorID string) (string, error) {
+	var mergedInto, status string
+	var count int
+	var mergedTags pq.StringArray
+	err := tx.QueryRow(`SELECT COALESCE(merged_into, ''), COALESCE(merged_status, ''), count, COALESCE(merged_tags, '{}') FROM alerts WHERE id = $1 FOR UPDATE`,
+		id).Scan(&mergedInto, &status, &count, &mergedTags)
+	if err != nil {
+		return "", err
+	}
+	if mergedInto != targetID {
+		return "", fmt.Errorf("%w: alert %s is not merged into %s", ErrInvalidTransition, id, targetID)
+	}
+	// Escalation was cancelled by the merge, a paging alert starts over
+	if status == db.AlertStatusEscalated || status == db.AlertStatusSnoozed {
+		status = db.AlertStatusNew
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE alerts SET status = $2, merged_into = NULL, merged_at = NULL, merged_status = NULL, merged_tags = NULL,
+			closed_by = CASE WHEN merged_status = 'closed' THEN closed_by END,
+			closed_at = CASE WHEN merged_status = 'closed' THEN closed_at END,
+			updated_at = $3
+		WHERE id = $1
+	`, id, status, now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return "", fmt.Errorf("%w: another open alert has the same dedup key as %s", ErrInvalidTransition, id)
+		}
+		return "", err
+	}
+	if _, err := tx.Exec(`UPDATE alerts SET count = GREATEST(count - $2, 1), updated_at = $3 WHERE id = $1`, targetID, count, now); err != nil {
+		return "", err
+	}
+	_, err = s.changeTags(tx, targetID, actorID, func(current []string) []string {
+		return slices.DeleteFunc(current, func(tag string) bool { return slices.Contains(mergedTags, tag) })
+	})
+	if err != nil {
+		return "", err
+	}
+
+	eventService := NewAlertEventService(s.PG, s.Redis)
+	event := userEvent(id, db.AlertEventUnmerged, actorID)
+	event.OldValue, event.NewValue, event.Message = db.AlertStatusClosed, status, "split out of alert "+targetID
+	if err := eventService.Record(tx, event); err != nil {
+		return "", err
+	}
+	event = userEvent(targetID, db.AlertEventUnmerged, actorID)
+	event.NewValue, event.Message = id, "count -"+strconv.Itoa(count)
+	return status, eventService.Record(tx, event)
+}
+
+// mergeAlertIDs reads the alerts of a merge or unmerge request, without
+// repeats
+func mergeAlertIDs(targetID string, c *gin.Context) ([]string, error) {
+	var req db.AlertMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMerge, err)
+	}
+
+	ids := []string{}
+	for _, id := range req.AlertIDs {
+		if id == targetID {
+			return nil, fmt.Errorf("%w: an alert cannot be merged with itself", ErrInvalidMerge)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxBulkAlerts {
+		return nil, fmt.Errorf("%w: at most %d alerts per request", ErrInvalidMerge, maxBulkAlerts)
+	}
+	return ids, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+var (
+	ErrNoteNotFound  = errors.New("note not found")
+	ErrNoteForbidden = errors.New("only the author can change this note")
+)
+
+type AlertNoteService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewAlertNoteService(pg *sql.DB, redis *redis.Client) *AlertNoteService {
+	return &AlertNoteService{PG: pg, Redis: redis}
+}
+
+// ListNotes returns the notes of an alert and of the alerts merged into it,
+// oldest first
+func (s *AlertNoteService) ListNotes(alertID string) ([]db.AlertNote, error) {
+	rows, err := s.PG.Query(`
+		SELECT n.id, n.alert_id, COALESCE(n.author_id, ''), COALESCE(u.name, ''), n.body, n.created_at, n.updated_at
+		FROM alert_notes n
+		LEFT JOIN users u ON u.id = n.author_id
+		WHERE n.alert_id = $1 OR n.alert_id IN (SELECT id FROM alerts WHERE merged_into = $1)
+		ORDER BY n.created_at
+	`, alertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []db.AlertNote{}
+	for rows.Next() {
+		var n db.AlertNote
+		if err := rows.Scan(&n.ID, &n.AlertID, &n.AuthorID, &n.AuthorName, &n.Body, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			continue
+		}
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
+
+func (s *AlertNoteService) CreateNote(alertID, authorID string, c *gin.Context) (db.AlertNote, error) {
+	var req db.AlertNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertNote{}, err
+	}
+	if _, err := NewAlertService(s.PG, s.Redis).GetAlert(alertID); err != nil {
+		return db.AlertNote{}, err
+	}
+
+	note := db.AlertNote{
+		ID:        uuid.New().String(),
+		AlertID:   alertID,
+		AuthorID:  authorID,
+		Body:      req.Body,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return note, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO alert_notes (id, alert_id, author_id, body, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6)`,
+		note.ID, note.AlertID, note.AuthorID, note.Body, note.CreatedAt, note.UpdatedAt)
+	if err != nil {
+		return note, err
+	}
+	if err := s.recordNote(tx, note, db.AlertEventNoteAdded, "", note.Body); err != nil {
+		return note, err
+	}
+	return note, tx.Commit()
+}
+
+// UpdateNote changes the body of a note. Only its author may edit it.
+func (s *AlertNoteService) UpdateNote(alertID, noteID, actorID string, c *gin.Context) (db.AlertNote, error) {
+	var req db.AlertNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertNote{}, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.AlertNote{}, err
+	}
+	defer tx.Rollback()
+
+	note, err := s.lockNote(tx, alertID, noteID, actorID)
+	if err != nil {
+		return note, err
+	}
+	previous := note.Body
+	note.Body, note.UpdatedAt = req.Body, time.Now()
+
+	if _, err := tx.Exec(`UPDATE alert_notes SET body = $2, updated_at = $3 WHERE id = $1`, note.ID, note.Body, note.UpdatedAt); err != nil {
+		return note, err
+	}
+	if err := s.recordNote(tx, note, db.AlertEventNoteUpdated, previous, note.Body); err != nil {
+		return note, err
+	}
+	return note, tx.Commit()
+}
+
+// DeleteNote removes a note. Only its author may delete it.
+func (s *AlertNoteService) DeleteNote(alertID, noteID, actorID string) error {
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	note, err := s.lockNote(tx, alertID, noteID, actorID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM alert_notes WHERE id = $1`, note.ID); err != nil {
+		return err
+	}
+	if err := s.recordNote(tx, note, db.AlertEventNoteDeleted, note.Body, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Helper functions
+
+// lockNote loads a note for a change by its author. The notes of merged
+// alerts can be changed through their target.
+func (s *AlertNoteService) lockNote(tx *sql.Tx, alertID, noteID, actorID string) (db.AlertNote, error) {
+	var n db.AlertNote
+	err := tx.QueryRow(`
+		SELECT id, alert_id, COALESCE(author_id, ''), body, created_at, updated_at FROM alert_notes
+		WHERE id = $1 AND (alert_id = $2 OR alert_id IN (SELECT id FROM alerts WHERE merged_into = $2))
+		FOR UPDATE
+	`, noteID, alertID).Scan(&n.ID, &n.AlertID, &n.AuthorID, &n.Body, &n.CreatedAt, &n.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return n, ErrNoteNotFound
+	} else if err != nil {
+		return n, err
+	}
+	if n.AuthorID != actorID {
+		return n, ErrNoteForbidden
+	}
+	return n, nil
+}
+
+func (s *AlertNoteService) recordNote(ex querier, note db.AlertNote, action, oldValue, newValue string) error {
+	event := userEvent(note.AlertID, action, note.AuthorID)
+	event.OldValue, event.NewValue, event.Message = oldValue, newValue, "note "+note.ID
+	return NewAlertEventService(s.PG, s.Redis).Record(ex, event)
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// Stale alerts closed or resolved per policy and run, the rest wait for the
+// next run
+const staleAlertBatch = 500
+
+var (
+	ErrAlertPolicyNotFound = errors.New("alert policy not found")
+	ErrNoOpenAlert         = errors.New("no open alert with this dedup_key")
+	ErrMissingDedupKey     = errors.New("dedup_key is required to resolve an alert")
+)
+
+type AlertPolicyService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewAlertPolicyService(pg *sql.DB, redis *redis.Client) *AlertPolicyService {
+	return &AlertPolicyService{PG: pg, Redis: redis}
+}
+
+const alertPolicySelect = `
+	SELECT id, name, source, severity, trigger, action, stale_minutes, is_active, created_at, updated_at
+	FROM alert_policies
+`
+
+// alertPolicyOrder puts the most specific policies first, those naming both
+// a source and a severity
+const alertPolicyOrder = ` ORDER BY source = '', severity = '', created_at`
+
+// Policy CRUD operations
+func (s *AlertPolicyService) ListPolicies() ([]db.AlertPolicy, error) {
+	return s.queryPolicies(alertPolicySelect + `WHERE is_active = true` + alertPolicyOrder)
+}
+
+func (s *AlertPolicyService) GetPolicy(id string) (db.AlertPolicy, error) {
+	policies, err := s.queryPolicies(alertPolicySelect+`WHERE id = $1`, id)
+	if err != nil {
+		return db.AlertPolicy{}, err
+	}
+	if len(policies) == 0 {
+		return db.AlertPolicy{}, ErrAlertPolicyNotFound
+	}
+	return policies[0], nil
+}
+
+func (s *AlertPolicyService) CreatePolicy(c *gin.Context) (db.AlertPolicy, error) {
+	var req db.AlertPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertPolicy{}, err
+	}
+	if err := validateAlertPolicy(&req); err != nil {
+		return db.AlertPolicy{}, err
+	}
+
+	policy := db.AlertPolicy{
+		ID:           uuid.New().String(),
+		Name:         req.Name,
+		Source:       req.Source,
+		Severity:     req.Severity,
+		Trigger:      req.Trigger,
+		Action:       req.Action,
+		StaleMinutes: req.StaleMinutes,
+		IsActive:     true,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO alert_policies (id, name, source, severity, trigger, action, stale_minutes, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
+		policy.ID, policy.Name, policy.Source, policy.Severity, policy.Trigger, policy.Action, policy.StaleMinutes, policy.IsActive, policy.CreatedAt, policy.UpdatedAt)
+	return policy, err
+}
+
+func (s *AlertPolicyService) UpdatePolicy(id string, c *gin.Context) (db.AlertPolicy, error) {
+	var req db.AlertPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.AlertPolicy{}, err
+	}
+	if err := validateAlertPolicy(&req); err != nil {
+		return db.AlertPolicy{}, err
+	}
+
+	result, err := s.PG.Exec(`UPDATE alert_policies SET name=$2, source=$3, severity=$4, trigger=$5, action=$6, stale_minutes=$7, updated_at=$8 WHERE id=$1 AND is_active = true`,
+		id, req.Name, req.Source, req.Severity, req.Trigger, req.Action, req.StaleMinutes, time.Now())
+	if err != nil {
+		return db.AlertPolicy{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return db.AlertPolicy{}, ErrAlertPolicyNotFound
+	}
+	return s.GetPolicy(id)
+}
+
+func (s *AlertPolicyService) DeletePolicy(id string) error {
+	_, err := s.PG.Exec(`UPDATE alert_policies SET is_active = false, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// ApplyStalePolicies resolves or closes the open alerts that had no update
+// for as long as a matching stale policy allows. Snoozed alerts are left
+// alone, they were put aside on purpose. It returns how many alerts changed.
+func (s *AlertPolicyService) ApplyStalePolicies() (int, error) {
+	policies, err := s.queryPolicies(alertPolicySelect+`WHERE is_active = true AND trigger = $1`+alertPolicyOrder, db.AlertPolicyStale)
+	if err != nil {
+		return 0, err
+	}
+
+	alertService := NewAlertService(s.PG, s.Redis)
+	changed := 0
+	for _, policy := range policies {
+		statuses := []string{db.AlertStatusNew, db.AlertStatusAcked, db.AlertStatusEscalated, db.AlertStatusSuppressed}
+		if policy.Action == db.AlertPolicyClose {
+			statuses = append(statuses, db.AlertStatusResolved)
+		}
+		where, args := alertFilterWhere(AlertFilter{
+			Statuses:   statuses,
+			Sources:    nonEmpty(policy.Source),
+			Severities: nonEmpty(policy.Severity),
+		})
+		args = append(args, time.Now().Add(-time.Duration(policy.StaleMinutes)*time.Minute), staleAlertBatch)
+
+		ids, err := s.queryAlertIDs(`SELECT a.id FROM alerts a WHERE `+where+fmt.Sprintf(` AND a.updated_at < $%d ORDER BY a.updated_at LIMIT $%d`, len(args)-1, len(args)), args...)
+		if err != nil {
+			return changed, err
+		}
+
+		message := fmt.Sprintf("%s: no update for %d minutes", policy.Name, policy.StaleMinutes)
+		for _, id := range ids {
+			// The alert may have changed since it was listed, the transition re-checks
+			_, err := alertService.transition(id, policyChange(id, policy, message))
+			if errors.Is(err, ErrInvalidTransition) {
+				continue
+			} else if err != nil {
+				log.Printf("Alert policy %s: failed to %s alert %s: %v", policy.ID, policy.Action, id, err)
+				continue
+			}
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// ResolveEvent handles a resolve event a source sent for a dedup key. The
+// first resolve_event policy matching the open alert with that key resolves
+// or closes it; without one the event is ignored. It returns the alert and
+// whether a policy applied.
+func (s *AlertPolicyService) ResolveEvent(dedupKey, source string) (db.AlertResponse, bool, error) {
+	if dedupKey == "" {
+		return db.AlertResponse{}, false, ErrMissingDedupKey
+	}
+	alertService := NewAlertService(s.PG, s.Redis)
+
+	var id string
+	err := s.PG.QueryRow(`SELECT id FROM alerts WHERE dedup_key = $1 AND status NOT IN ('resolved', 'closed')`, dedupKey).Scan(&id)
+	if err == sql.ErrNoRows {
+		return db.AlertResponse{}, false, ErrNoOpenAlert
+	} else if err != nil {
+		return db.AlertResponse{}, false, err
+	}
+	alert, err := alertService.GetAlert(id)
+	if err != nil {
+		return alert, false, err
+	}
+
+	policies, err := s.queryPolicies(alertPolicySelect+`WHERE is_active = true AND trigger = $1 AND source IN ('', $2) AND severity IN ('', $3)`+alertPolicyOrder,
+		db.AlertPolicyResolveEvent, alert.Source, alert.Severity)
+	if err != nil || len(policies) == 0 {
+		return alert, false, err
+	}
+
+	policy := policies[0]
+	if _, err := alertService.transition(id, policyChange(id, policy, policy.Name+": resolve event from "+source)); err != nil {
+		return alert, false, err
+	}
+	alert, err = alertService.GetAlert(id)
+	return alert, true, err
+}
+
+// Helper functions
+
+// policyChange is the resolve or close of an alert by a policy
+func policyChange(id string, policy db.AlertPolicy, message string) statusChange {
+	change := resolveChange(id, "")
+	if policy.Action == db.AlertPolicyClose {
+		change = closeChange(id, "")
+	}
+	change.event.ActorType, change.event.ActorID, change.event.Message = db.ActorPolicy, policy.ID, message
+	return change
+}
+
+func validateAlertPolicy(req *db.AlertPolicyRequest) error {
+	if req.Trigger == db.AlertPolicyStale && req.StaleMinutes <= 0 {
+		return errors.New("stale_minutes is required for stale policies")
+	}
+	if req.Trigger != db.AlertPolicyStale {
+		req.StaleMinutes = 0
+	}
+	return nil
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func (s *AlertPolicyService) queryPolicies(query string, args ...interface{}) ([]db.AlertPolicy, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []db.AlertPolicy{}
+	for rows.Next() {
+		var p db.AlertPolicy
+		if err := rows.Scan(&p.ID, &p.Name, &p.Source, &p.Severity, &p.Trigger, &p.Action, &p.StaleMinutes, &p.IsActive, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			continue
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func (s *AlertPolicyService) queryAlertIDs(query string, args ...interface{}) ([]string, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
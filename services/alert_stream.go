@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// alertStreamChannel is the Redis channel alert changes are published on.
+// Every API instance relays it to its own stream clients.
+const alertStreamChannel = "alerts:stream"
+
+// Changes buffered per stream client, a client further behind misses them
+const alertStreamBuffer = 64
+
+// AlertStreamService relays the alert changes published by all instances to
+// the stream clients connected to this one. It holds one Redis subscription
+// for all of them, opened with the first client.
+type AlertStreamService struct {
+	Redis *redis.Client
+
+	once        sync.Once
+	mu          sync.Mutex
+	subscribers map[chan db.AlertStreamEvent]AlertFilter
+}
+
+func NewAlertStreamService(redis *redis.Client) *AlertStreamService {
+	return &AlertStreamService{Redis: redis, subscribers: map[chan db.AlertStreamEvent]AlertFilter{}}
+}
+
+// Subscribe returns the changes of the alerts matching the filter. Only the
+// status, severity, source, assignee, team and tag filters apply. Call the
+// returned function once the client is gone, it closes the channel.
+func (s *AlertStreamService) Subscribe(filter AlertFilter) (<-chan db.AlertStreamEvent, func()) {
+	s.once.Do(func() { go s.relay() })
+
+	filter.Tags = normalizeTags(filter.Tags)
+	events := make(chan db.AlertStreamEvent, alertStreamBuffer)
+	s.mu.Lock()
+	s.subscribers[events] = filter
+	s.mu.Unlock()
+
+	return events, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[events]; ok {
+			delete(s.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// relay passes the published changes to the subscribers. The subscription
+// reconnects on its own when Redis goes away.
+func (s *AlertStreamService) relay() {
+	pubsub := s.Redis.Subscribe(context.Background(), alertStreamChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var event db.AlertStreamEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Printf("Invalid alert stream message: %v", err)
+			continue
+		}
+		s.broadcast(event)
+	}
+}
+
+func (s *AlertStreamService) broadcast(event db.AlertStreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for events, filter := range s.subscribers {
+		if !streamFilterMatch(filter, event.Alert) {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			// Do not hold up the other clients for a slow one
+		}
+	}
+}
+
+// Helper functions
+
+// publishAlertEvent publishes a change recorded on an alert's timeline to
+// the alert stream. The alert is read through ex, so inside a transaction it
+// already shows the change. A failure is only logged, the change itself
+// still goes through.
+func publishAlertEvent(rdb *redis.Client, ex querier, event db.AlertEvent) {
+	streamType := alertStreamType(event.Action)
+	if streamType == "" {
+		return
+	}
+
+	alert, err := scanAlert(ex.QueryRow(alertSelect+`WHERE a.id = $1`, event.AlertID))
+	if err != nil {
+		log.Printf("Failed to load alert %s for the stream: %v", event.AlertID, err)
+		return
+	}
+	b, err := json.Marshal(db.AlertStreamEvent{Type: streamType, AlertID: event.AlertID, Alert: alert, Event: event})
+	if err != nil {
+		log.Printf("Failed to encode stream event for alert %s: %v", event.AlertID, err)
+		return
+	}
+	if err := rdb.Publish(context.Background(), alertStreamChannel, b).Err(); err != nil {
+		log.Printf("Failed to publish stream event for alert %s: %v", event.AlertID, err)
+	}
+}
+
+// alertStreamType is the stream event type of a timeline action, empty for
+// the actions that do not change the alert
+func alertStreamType(action string) string {
+	switch action {
+	case db.AlertEventNotified, db.AlertEventNotificationReplay:
+		return ""
+	case db.AlertEventCreated:
+		return db.AlertStreamCreated
+	case db.AlertEventAcked:
+		return db.AlertStreamAcked
+	case db.AlertEventEscalated, db.AlertEventEscalationExhausted:
+		return db.AlertStreamEscalated
+	case db.AlertEventResolved:
+		return db.AlertStreamResolved
+	case db.AlertEventClosed:
+		return db.AlertStreamClosed
+	default:
+		return db.AlertStreamUpdated
+	}
+}
+
+// streamFilterMatch checks an alert against the filter of a stream client,
+// the same way alertFilterWhere does in SQL
+func streamFilterMatch(filter AlertFilter, alert db.AlertResponse) bool {
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, alert.Status) {
+		return false
+	}
+	if len(filter.Severities) > 0 && !slices.Contains(filter.Severities, alert.Severity) {
+		return false
+	}
+	if len(filter.Sources) > 0 && !slices.Contains(filter.Sources, alert.Source) {
+		return false
+	}
+	if filter.AssignedTo != "" && filter.AssignedTo != alert.AssignedTo {
+		return false
+	}
+	if filter.TeamID != "" && filter.TeamID != alert.TeamID {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		if !slices.Contains(alert.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
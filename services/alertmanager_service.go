@@ -3,9 +3,11 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/vanchonlee/oncallkit/db"
 	"github.com/vanchonlee/oncallkit/models"
 )
@@ -34,7 +36,7 @@ func (s *AlertManagerService) ProcessWebhook(webhook *models.AlertManagerWebhook
 		// Handle different alert statuses
 		switch amAlert.Status {
 		case "firing":
-			err = s.handleFiringAlert(alert, &amAlert)
+			err = s.handleFiringAlert(alert, &amAlert, webhook.GroupKey)
 		case "resolved":
 			err = s.handleResolvedAlert(alert, &amAlert)
 		default:
@@ -51,10 +53,10 @@ func (s *AlertManagerService) ProcessWebhook(webhook *models.AlertManagerWebhook
 
 // convertToInternalAlert converts AlertManager alert to internal alert format
 func (s *AlertManagerService) convertToInternalAlert(webhook *models.AlertManagerWebhook, amAlert *models.AlertManagerAlert) (*db.Alert, error) {
-	// Generate alert ID based on fingerprint or labels
-	alertID := amAlert.Fingerprint
-	if alertID == "" {
-		alertID = s.generateAlertID(amAlert.Labels)
+	// Repeated notifications for the same fingerprint or labels update one alert
+	dedupKey := amAlert.Fingerprint
+	if dedupKey == "" {
+		dedupKey = s.generateAlertID(amAlert.Labels)
 	}
 
 	// Extract severity from labels
@@ -64,12 +66,12 @@ func (s *AlertManagerService) convertToInternalAlert(webhook *models.AlertManage
 	description := s.createDescription(amAlert.Annotations, amAlert.Labels)
 
 	alert := &db.Alert{
-		ID:          alertID,
 		Title:       amAlert.Labels["alertname"],
 		Description: description,
 		Severity:    severity,
-		Status:      "new",
+		Status:      db.AlertStatusNew,
 		Source:      "alertmanager",
+		DedupKey:    dedupKey,
 		CreatedAt:   amAlert.StartsAt,
 		UpdatedAt:   time.Now(),
 	}
@@ -77,65 +79,53 @@ func (s *AlertManagerService) convertToInternalAlert(webhook *models.AlertManage
 	return alert, nil
 }
 
-// handleFiringAlert handles firing alerts
-func (s *AlertManagerService) handleFiringAlert(alert *db.Alert, amAlert *models.AlertManagerAlert) error {
-	// Check if alert already exists
-	var existingAlert db.Alert
-	err := s.PG.QueryRow("SELECT id, status FROM alerts WHERE id = $1", alert.ID).Scan(&existingAlert.ID, &existingAlert.Status)
-
-	if err == sql.ErrNoRows {
-		// Create new alert
-		alert.Status = "new"
-		_, err = s.PG.Exec(`INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
-			alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt, alert.Severity, alert.Source)
-		return err
-	} else if err != nil {
-		return err
-	}
-
-	// Update existing alert if it was closed
-	if existingAlert.Status == "closed" {
-		now := time.Now()
-		_, err = s.PG.Exec("UPDATE alerts SET status = 'new', updated_at = $1 WHERE id = $2", now, alert.ID)
-		return err
-	}
-
-	return nil
+// handleFiringAlert creates the alert, routed to a team by its labels. While
+// an alert for the same fingerprint is open, its count goes up instead. The
+// group key of the notification is there for alertmanager_group grouping
+// rules.
+func (s *AlertManagerService) handleFiringAlert(alert *db.Alert, amAlert *models.AlertManagerAlert, groupKey string) error {
+	_, err := s.AlertService.CreateRoutedAlert(alert, AlertRoute{Labels: amAlert.Labels, GroupKey: groupKey})
+	return err
 }
 
-// handleResolvedAlert handles resolved alerts
+// handleResolvedAlert resolves the open alert of the fingerprint
 func (s *AlertManagerService) handleResolvedAlert(alert *db.Alert, amAlert *models.AlertManagerAlert) error {
-	var existingAlert db.Alert
-	err := s.PG.QueryRow("SELECT id, status FROM alerts WHERE id = $1", alert.ID).Scan(&existingAlert.ID, &existingAlert.Status)
+	var alertID string
+	err := s.PG.QueryRow("SELECT id FROM alerts WHERE dedup_key = $1 AND status NOT IN ('resolved', 'closed')", alert.DedupKey).Scan(&alertID)
 
 	if err == sql.ErrNoRows {
-		// Alert doesn't exist, create it as closed
-		alert.Status = "closed"
-		_, err = s.PG.Exec(`INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
-			alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt, alert.Severity, alert.Source)
-		return err
+		// No open alert, record it as resolved
+		alert.ID = uuid.New().String()
+		alert.Status = db.AlertStatusResolved
+		_, err = s.PG.Exec(`INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source, dedup_key, resolved_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$6)`,
+			alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt, alert.Severity, alert.Source, alert.DedupKey)
+		if err != nil {
+			return err
+		}
+		return NewAlertEventService(s.PG, s.AlertService.Redis).Record(s.PG, db.AlertEvent{
+			AlertID:  alert.ID,
+			Action:   db.AlertEventCreated,
+			NewValue: alert.Status,
+			Message:  "resolved in AlertManager before it was seen firing",
+		})
 	} else if err != nil {
 		return err
 	}
 
-	// Update existing alert to closed
-	if existingAlert.Status != "closed" {
-		now := time.Now()
-		_, err = s.PG.Exec("UPDATE alerts SET status = 'closed', updated_at = $1 WHERE id = $2", now, alert.ID)
-		return err
-	}
-
-	return nil
+	// Resolve the open alert, stopping any escalation in flight
+	_, err = s.AlertService.ResolveAlert(alertID, "")
+	return err
 }
 
 // Helper functions
 
 func (s *AlertManagerService) generateAlertID(labels map[string]string) string {
-	// Create a consistent ID from labels
+	// Create a consistent ID from labels, in a stable order
 	var parts []string
 	for key, value := range labels {
 		parts = append(parts, fmt.Sprintf("%s=%s", key, value))
 	}
+	sort.Strings(parts)
 	return fmt.Sprintf("am-%x", strings.Join(parts, ","))
 }
 
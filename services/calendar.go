@@ -0,0 +1,561 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// Calendar feed window, kept inside maxShiftRange
+const (
+	calendarPast   = 7 * 24 * time.Hour
+	calendarFuture = 84 * 24 * time.Hour
+)
+
+// Imported recurring events are expanded at most this far ahead
+const (
+	importHorizon        = 366 * 24 * time.Hour
+	maxImportOccurrences = 1000
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+type CalendarService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewCalendarService(pg *sql.DB, redis *redis.Client) *CalendarService {
+	return &CalendarService{PG: pg, Redis: redis}
+}
+
+// RotationCalendar renders the computed shifts of a rotation, overrides
+// included, as an iCalendar feed
+func (s *CalendarService) RotationCalendar(rotationID string) ([]byte, error) {
+	rotationService := NewRotationService(s.PG, s.Redis)
+	rotation, err := rotationService.GetRotation(rotationID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	shifts, err := rotationService.Shifts(rotation.ID, now.Add(-calendarPast), now.Add(calendarFuture))
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.userNames()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]db.OnCallSchedule, 0, len(shifts))
+	summaries := make([]string, 0, len(shifts))
+	for _, shift := range shifts {
+		entries = append(entries, db.OnCallSchedule{
+			ID:        fmt.Sprintf("%s-%d", rotation.ID, shift.Start.Unix()),
+			UserID:    shift.UserID,
+			StartTime: shift.Start,
+			EndTime:   shift.End,
+			TimeZone:  rotation.TimeZone,
+		})
+		summaries = append(summaries, "On call: "+names[shift.UserID])
+	}
+	return writeCalendar(rotation.Name, rotation.TimeZone, entries, summaries), nil
+}
+
+// UserCalendar renders every shift of one user: rotation shifts plus hand
+// entered schedule rows
+func (s *CalendarService) UserCalendar(userID string) ([]byte, error) {
+	user, err := NewUserService(s.PG, s.Redis).GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	from, to := now.Add(-calendarPast), now.Add(calendarFuture)
+
+	var entries []db.OnCallSchedule
+	var summaries []string
+
+	rotationService := NewRotationService(s.PG, s.Redis)
+	rotations, err := rotationService.ListRotations()
+	if err != nil {
+		return nil, err
+	}
+	for _, rotation := range rotations {
+		shifts, err := rotationService.Shifts(rotation.ID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, shift := range shifts {
+			if shift.UserID != user.ID {
+				continue
+			}
+			entries = append(entries, db.OnCallSchedule{
+				ID:        fmt.Sprintf("%s-%d", rotation.ID, shift.Start.Unix()),
+				UserID:    user.ID,
+				StartTime: shift.Start,
+				EndTime:   shift.End,
+				TimeZone:  rotation.TimeZone,
+			})
+			summaries = append(summaries, "On call: "+rotation.Name)
+		}
+	}
+
+	schedules, err := NewUserService(s.PG, s.Redis).ListUserOnCallSchedules(user.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		entries = append(entries, schedule)
+		summaries = append(summaries, "On call")
+	}
+
+	return writeCalendar("On-call shifts for "+user.Name, "", entries, summaries), nil
+}
+
+// ImportCalendar reads an ICS file (multipart field "file" or the raw body)
+// and creates a schedule row per event. Events are matched to users by the
+// user_id parameter, then attendee or organizer email, then a user name or
+// email in the summary.
+func (s *CalendarService) ImportCalendar(c *gin.Context) (db.CalendarImportResult, error) {
+	result := db.CalendarImportResult{Created: []db.OnCallSchedule{}, Skipped: []db.CalendarImportSkip{}}
+
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return result, err
+		}
+		defer f.Close()
+		body = f
+	}
+
+	timeZone := c.DefaultQuery("time_zone", c.DefaultPostForm("time_zone", "UTC"))
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return result, fmt.Errorf("invalid time_zone %q", timeZone)
+	}
+	fixedUserID := c.DefaultQuery("user_id", c.PostForm("user_id"))
+	teamID := c.DefaultQuery("team_id", c.PostForm("team_id"))
+	if teamID != "" {
+		if _, err := NewTeamService(s.PG, s.Redis).GetTeam(teamID); err != nil {
+			return result, err
+		}
+	}
+
+	events, err := parseCalendar(body)
+	if err != nil {
+		return result, err
+	}
+	if len(events) == 0 {
+		return result, errors.New("no events found in calendar")
+	}
+
+	userService := NewUserService(s.PG, s.Redis)
+	users, err := userService.ListUsers()
+	if err != nil {
+		return result, err
+	}
+
+	for _, event := range events {
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, db.CalendarImportSkip{UID: event.UID, Summary: event.Summary, Reason: reason})
+		}
+
+		if strings.EqualFold(event.Status, "CANCELLED") {
+			skip("event is cancelled")
+			continue
+		}
+		userID := fixedUserID
+		if userID == "" {
+			userID = matchEventUser(event, users)
+		}
+		if userID == "" {
+			skip("no matching user")
+			continue
+		}
+
+		occurrences, err := event.occurrences(loc)
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+
+		zone := timeZone
+		if _, err := time.LoadLocation(event.TimeZone); event.TimeZone != "" && err == nil {
+			zone = event.TimeZone
+		}
+		for _, o := range occurrences {
+			var exists bool
+			err := s.PG.QueryRow(`SELECT EXISTS (SELECT 1 FROM on_call_schedules WHERE user_id = $1 AND start_time = $2 AND end_time = $3 AND is_active = true)`,
+				userID, o[0], o[1]).Scan(&exists)
+			if err != nil {
+				return result, err
+			}
+			if exists {
+				skip("already imported")
+				continue
+			}
+
+			schedule, err := userService.AddOnCallSchedule(db.OnCallSchedule{UserID: userID, StartTime: o[0], EndTime: o[1], TimeZone: zone, TeamID: teamID})
+			if err != nil {
+				skip(err.Error())
+				continue
+			}
+			result.Created = append(result.Created, schedule)
+		}
+	}
+	return result, nil
+}
+
+// Helper functions
+
+func (s *CalendarService) userNames() (map[string]string, error) {
+	users, err := NewUserService(s.PG, s.Redis).ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}
+
+// writeCalendar renders schedule entries as an RFC 5545 calendar. Times are
+// written in UTC, the zone is only a display hint for calendar apps.
+func writeCalendar(name, timeZone string, entries []db.OnCallSchedule, summaries []string) []byte {
+	var b bytes.Buffer
+	line := func(s string) {
+		// Fold lines longer than 75 octets without splitting UTF-8 sequences
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//SLAR//On-Call Schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICSText(name))
+	if timeZone != "" {
+		line("X-WR-TIMEZONE:" + timeZone)
+	}
+
+	stamp := time.Now().UTC().Format(icsTimeFormat)
+	for i, e := range entries {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.ID + "@slar")
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + e.StartTime.UTC().Format(icsTimeFormat))
+		line("DTEND:" + e.EndTime.UTC().Format(icsTimeFormat))
+		line("SUMMARY:" + escapeICSText(summaries[i]))
+		if e.TimeZone != "" {
+			line("DESCRIPTION:" + escapeICSText("Time zone: "+e.TimeZone))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Bytes()
+}
+
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+func unescapeICSText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// icsProperty is one content line: NAME;PARAM=VALUE:value
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsEvent holds the VEVENT fields the importer understands
+type icsEvent struct {
+	UID       string
+	Summary   string
+	Status    string
+	Start     icsProperty
+	End       icsProperty
+	Duration  string
+	RRule     string
+	Attendees []string
+	TimeZone  string
+}
+
+// parseCalendar unfolds content lines and collects VEVENT components
+func parseCalendar(r io.Reader) ([]icsEvent, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += text[1:]
+			continue
+		}
+		lines = append(lines, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []icsEvent
+	var current *icsEvent
+	depth := 0 // Nested components inside a VEVENT, e.g. VALARM
+	for _, text := range lines {
+		if text == "" {
+			continue
+		}
+		prop := parseICSProperty(text)
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VEVENT"):
+			current = &icsEvent{}
+			depth = 0
+			continue
+		case current == nil:
+			continue
+		case prop.Name == "BEGIN":
+			depth++
+			continue
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VEVENT"):
+			events = append(events, *current)
+			current = nil
+			continue
+		case prop.Name == "END":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch prop.Name {
+		case "UID":
+			current.UID = prop.Value
+		case "SUMMARY":
+			current.Summary = unescapeICSText(prop.Value)
+		case "STATUS":
+			current.Status = prop.Value
+		case "DTSTART":
+			current.Start = prop
+			current.TimeZone = prop.Params["TZID"]
+		case "DTEND":
+			current.End = prop
+		case "DURATION":
+			current.Duration = prop.Value
+		case "RRULE":
+			current.RRule = prop.Value
+		case "ATTENDEE", "ORGANIZER":
+			current.Attendees = append(current.Attendees, prop.Value)
+		}
+	}
+	return events, nil
+}
+
+func parseICSProperty(text string) icsProperty {
+	prop := icsProperty{Params: map[string]string{}}
+
+	// The value starts at the first colon outside a quoted parameter
+	inQuotes, split := false, len(text)
+	for i, ch := range text {
+		if ch == '"' {
+			inQuotes = !inQuotes
+		} else if ch == ':' && !inQuotes {
+			split = i
+			break
+		}
+	}
+	head := text[:split]
+	if split < len(text) {
+		prop.Value = text[split+1:]
+	}
+
+	parts := strings.Split(head, ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			prop.Params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return prop
+}
+
+// parseICSTime reads DATE, UTC, TZID and floating date-times. Floating
+// times and unknown TZIDs use the import time zone.
+func parseICSTime(prop icsProperty, loc *time.Location) (time.Time, error) {
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	value := prop.Value
+	switch {
+	case prop.Params["VALUE"] == "DATE" || len(value) == 8:
+		return time.ParseInLocation("20060102", value, loc)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse(icsTimeFormat, value)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+var icsDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICSDuration reads durations like P1D, PT12H or P1DT2H30M
+func parseICSDuration(value string) (days int, clock time.Duration, err error) {
+	m := icsDurationPattern.FindStringSubmatch(value)
+	if m == nil || m[1] == "-" {
+		return 0, 0, fmt.Errorf("unsupported DURATION %q", value)
+	}
+	n := func(s string) int {
+		v, _ := strconv.Atoi(s)
+		return v
+	}
+	days = n(m[2])*7 + n(m[3])
+	clock = time.Duration(n(m[4]))*time.Hour + time.Duration(n(m[5]))*time.Minute + time.Duration(n(m[6]))*time.Second
+	return days, clock, nil
+}
+
+// occurrences expands an event into start/end pairs. Only DAILY and WEEKLY
+// rules with INTERVAL, COUNT and UNTIL are supported.
+func (e icsEvent) occurrences(loc *time.Location) ([][2]time.Time, error) {
+	if e.Start.Value == "" {
+		return nil, errors.New("event has no DTSTART")
+	}
+	start, err := parseICSTime(e.Start, loc)
+	if err != nil {
+		return nil, errors.New("invalid DTSTART")
+	}
+
+	// Keep the event length in calendar days plus clock time so recurring
+	// shifts keep their local handoff across DST changes
+	var days int
+	var clock time.Duration
+	switch {
+	case e.End.Value != "":
+		end, err := parseICSTime(e.End, loc)
+		if err != nil {
+			return nil, errors.New("invalid DTEND")
+		}
+		y1, m1, d1 := start.Date()
+		y2, m2, d2 := end.In(start.Location()).Date()
+		days = int(time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+		clock = end.Sub(start.AddDate(0, 0, days))
+	case e.Duration != "":
+		if days, clock, err = parseICSDuration(e.Duration); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("event has no DTEND or DURATION")
+	}
+	endOf := func(t time.Time) time.Time { return t.AddDate(0, 0, days).Add(clock) }
+	if !endOf(start).After(start) {
+		return nil, errors.New("event ends before it starts")
+	}
+
+	if e.RRule == "" {
+		return [][2]time.Time{{start, endOf(start)}}, nil
+	}
+
+	rule := map[string]string{}
+	for _, part := range strings.Split(e.RRule, ";") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			rule[strings.ToUpper(k)] = v
+		}
+	}
+	step := 0
+	switch rule["FREQ"] {
+	case "DAILY":
+		step = 1
+	case "WEEKLY":
+		step = 7
+	}
+	for k := range rule {
+		if k != "FREQ" && k != "INTERVAL" && k != "COUNT" && k != "UNTIL" && k != "WKST" {
+			step = 0
+		}
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("unsupported RRULE %q", e.RRule)
+	}
+	if v, ok := rule["INTERVAL"]; ok {
+		interval, err := strconv.Atoi(v)
+		if err != nil || interval < 1 {
+			return nil, fmt.Errorf("unsupported RRULE %q", e.RRule)
+		}
+		step *= interval
+	}
+
+	count := maxImportOccurrences
+	if v, ok := rule["COUNT"]; ok {
+		if c, err := strconv.Atoi(v); err == nil && c < count {
+			count = c
+		}
+	}
+	until := time.Now().Add(importHorizon)
+	if v, ok := rule["UNTIL"]; ok {
+		if u, err := parseICSTime(icsProperty{Value: v, Params: map[string]string{}}, start.Location()); err == nil && u.Before(until) {
+			until = u
+		}
+	}
+
+	var occurrences [][2]time.Time
+	for k := 0; k < count; k++ {
+		s := start.AddDate(0, 0, k*step)
+		if s.After(until) {
+			break
+		}
+		occurrences = append(occurrences, [2]time.Time{s, endOf(s)})
+	}
+	return occurrences, nil
+}
+
+// matchEventUser finds the user an imported event belongs to
+func matchEventUser(event icsEvent, users []db.User) string {
+	for _, attendee := range event.Attendees {
+		email := strings.TrimPrefix(strings.ToLower(attendee), "mailto:")
+		for _, u := range users {
+			if strings.EqualFold(u.Email, email) {
+				return u.ID
+			}
+		}
+	}
+
+	// Prefer the longest match so "Anna Nguyen" wins over "Anna"
+	summary := strings.ToLower(event.Summary)
+	match, matchLen := "", 0
+	for _, u := range users {
+		for _, candidate := range []string{u.Email, u.Name} {
+			candidate = strings.ToLower(candidate)
+			if candidate != "" && len(candidate) > matchLen && strings.Contains(summary, candidate) {
+				match, matchLen = u.ID, len(candidate)
+			}
+		}
+	}
+	return match
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+type CoverageService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewCoverageService(pg *sql.DB, redis *redis.Client) *CoverageService {
+	return &CoverageService{PG: pg, Redis: redis}
+}
+
+// Coverage reports gaps and overlapping shifts between from and to. With a
+// rotation ID only that rotation is checked. With a team ID the team's
+// rotations and schedule rows count, like GetTeamOnCallUser; otherwise every
+// active rotation and schedule row of any team does.
+func (s *CoverageService) Coverage(from, to time.Time, rotationID, teamID string) (db.CoverageReport, error) {
+	report := db.CoverageReport{From: from.UTC(), To: to.UTC(), RotationID: rotationID, TeamID: teamID, Gaps: []db.TimeRange{}, Overlaps: []db.ScheduleOverlap{}}
+	if !to.After(from) {
+		return report, errors.New("to must be after from")
+	}
+
+	rotationService := NewRotationService(s.PG, s.Redis)
+	var covered []db.TimeRange
+
+	if rotationID != "" {
+		shifts, err := rotationService.Shifts(rotationID, from, to)
+		if err != nil {
+			return report, err
+		}
+		for _, shift := range shifts {
+			covered = append(covered, db.TimeRange{Start: shift.Start, End: shift.End})
+		}
+	} else {
+		var rotations []db.Rotation
+		var err error
+		if teamID != "" {
+			rotations, err = rotationService.ListTeamRotations(teamID)
+		} else {
+			rotations, err = rotationService.ListRotations()
+		}
+		if err != nil {
+			return report, err
+		}
+		for _, rotation := range rotations {
+			shifts, err := rotationService.Shifts(rotation.ID, from, to)
+			if err != nil {
+				return report, err
+			}
+			for _, shift := range shifts {
+				covered = append(covered, db.TimeRange{Start: shift.Start, End: shift.End})
+			}
+		}
+
+		schedules, err := s.schedulesBetween(from, to, teamID)
+		if err != nil {
+			return report, err
+		}
+		for _, schedule := range schedules {
+			covered = append(covered, db.TimeRange{Start: schedule.StartTime, End: schedule.EndTime})
+		}
+		report.Overlaps = scheduleOverlaps(schedules)
+	}
+
+	report.Gaps = coverageGaps(covered, report.From, report.To)
+	return report, nil
+}
+
+// Helper functions
+
+// schedulesBetween returns the schedule rows of a team, or of everyone when
+// teamID is empty
+func (s *CoverageService) schedulesBetween(from, to time.Time, teamID string) ([]db.OnCallSchedule, error) {
+	rows, err := s.PG.Query(`SELECT id, user_id, start_time, end_time, time_zone, COALESCE(team_id, ''), is_active, created_at FROM on_call_schedules WHERE is_active = true AND start_time < $2 AND end_time > $1 AND ($3 = '' OR team_id = $3) ORDER BY start_time`,
+		from, to, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []db.OnCallSchedule
+	for rows.Next() {
+		var s db.OnCallSchedule
+		err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &s.EndTime, &s.TimeZone, &s.TeamID, &s.IsActive, &s.CreatedAt)
+		if err != nil {
+			continue
+		}
+		s.StartTime, s.EndTime = s.StartTime.UTC(), s.EndTime.UTC()
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// coverageGaps returns the parts of [from, to) not covered by any range
+func coverageGaps(covered []db.TimeRange, from, to time.Time) []db.TimeRange {
+	sort.Slice(covered, func(i, j int) bool { return covered[i].Start.Before(covered[j].Start) })
+
+	gaps := []db.TimeRange{}
+	cursor := from
+	for _, r := range covered {
+		if !cursor.Before(to) {
+			break
+		}
+		if r.Start.After(cursor) {
+			end := r.Start
+			if end.After(to) {
+				end = to
+			}
+			gaps = append(gaps, db.TimeRange{Start: cursor, End: end})
+		}
+		if r.End.After(cursor) {
+			cursor = r.End
+		}
+	}
+	if cursor.Before(to) {
+		gaps = append(gaps, db.TimeRange{Start: cursor, End: to})
+	}
+	return gaps
+}
+
+// scheduleOverlaps pairs up schedule rows of the same team that cover the
+// same time. schedules must be sorted by start time.
+func scheduleOverlaps(schedules []db.OnCallSchedule) []db.ScheduleOverlap {
+	overlaps := []db.ScheduleOverlap{}
+	for i, a := range schedules {
+		for _, b := range schedules[i+1:] {
+			if !b.StartTime.Before(a.EndTime) {
+				break
+			}
+			if a.TeamID != b.TeamID {
+				continue
+			}
+			end := a.EndTime
+			if b.EndTime.Before(end) {
+				end = b.EndTime
+			}
+			overlaps = append(overlaps, db.ScheduleOverlap{
+				Start:       b.StartTime,
+				End:         end,
+				ScheduleIDs: []string{a.ID, b.ID},
+				UserIDs:     []string{a.UserID, b.UserID},
+			})
+		}
+	}
+	return overlaps
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// DefaultEscalationLevel is used for alerts without an escalation policy:
+// page the current on-call user and escalate after 5 minutes without ACK.
+var DefaultEscalationLevel = db.EscalationLevel{
+	LevelNumber:  1,
+	DelayMinutes: 5,
+	TargetType:   db.EscalationTargetSchedule,
+}
+
+type EscalationService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewEscalationService(pg *sql.DB, redis *redis.Client) *EscalationService {
+	return &EscalationService{PG: pg, Redis: redis}
+}
+
+// Policy CRUD operations
+func (s *EscalationService) ListPolicies() ([]db.EscalationPolicy, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, name, COALESCE(description, ''), COALESCE(sources, '{}'), is_default, is_active, created_at, updated_at
+		FROM escalation_policies
+		WHERE is_active = true
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []db.EscalationPolicy
+	for rows.Next() {
+		var p db.EscalationPolicy
+		var sources pq.StringArray
+		err := rows.Scan(&p.ID, &p.Name, &p.Description, &sources, &p.IsDefault, &p.IsActive, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		p.Sources = []string(sources)
+		policies = append(policies, p)
+	}
+
+	for i := range policies {
+		levels, err := s.listLevels(policies[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		policies[i].Levels = levels
+	}
+	return policies, nil
+}
+
+func (s *EscalationService) GetPolicy(id string) (db.EscalationPolicy, error) {
+	var p db.EscalationPolicy
+	var sources pq.StringArray
+	err := s.PG.QueryRow(`
+		SELECT id, name, COALESCE(description, ''), COALESCE(sources, '{}'), is_default, is_active, created_at, updated_at
+		FROM escalation_policies
+		WHERE id = $1
+	`, id).Scan(&p.ID, &p.Name, &p.Description, &sources, &p.IsDefault, &p.IsActive, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	p.Sources = []string(sources)
+
+	p.Levels, err = s.listLevels(p.ID)
+	return p, err
+}
+
+func (s *EscalationService) CreatePolicy(c *gin.Context) (db.EscalationPolicy, error) {
+	var req db.EscalationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.EscalationPolicy{}, err
+	}
+
+	policy := db.EscalationPolicy{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		Sources:     req.Sources,
+		IsDefault:   req.IsDefault,
+		IsActive:    true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if policy.Sources == nil {
+		policy.Sources = []string{}
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return policy, err
+	}
+	defer tx.Rollback()
+
+	if policy.IsDefault {
+		if _, err := tx.Exec(`UPDATE escalation_policies SET is_default = false WHERE is_default = true`); err != nil {
+			return policy, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO escalation_policies (id, name, description, sources, is_default, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		policy.ID, policy.Name, policy.Description, pq.Array(policy.Sources), policy.IsDefault, policy.IsActive, policy.CreatedAt, policy.UpdatedAt)
+	if err != nil {
+		return policy, err
+	}
+
+	policy.Levels, err = s.insertLevels(tx, policy.ID, req.Levels)
+	if err != nil {
+		return policy, err
+	}
+
+	return policy, tx.Commit()
+}
+
+// UpdatePolicy replaces the policy definition, including all of its levels
+func (s *EscalationService) UpdatePolicy(id string, c *gin.Context) (db.EscalationPolicy, error) {
+	var req db.EscalationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.EscalationPolicy{}, err
+	}
+	if req.Sources == nil {
+		req.Sources = []string{}
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.EscalationPolicy{}, err
+	}
+	defer tx.Rollback()
+
+	if req.IsDefault {
+		if _, err := tx.Exec(`UPDATE escalation_policies SET is_default = false WHERE is_default = true AND id != $1`, id); err != nil {
+			return db.EscalationPolicy{}, err
+		}
+	}
+
+	result, err := tx.Exec(`UPDATE escalation_policies SET name=$2, description=$3, sources=$4, is_default=$5, updated_at=$6 WHERE id=$1`,
+		id, req.Name, req.Description, pq.Array(req.Sources), req.IsDefault, time.Now())
+	if err != nil {
+		return db.EscalationPolicy{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return db.EscalationPolicy{}, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`DELETE FROM escalation_levels WHERE policy_id = $1`, id); err != nil {
+		return db.EscalationPolicy{}, err
+	}
+	if _, err := s.insertLevels(tx, id, req.Levels); err != nil {
+		return db.EscalationPolicy{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.EscalationPolicy{}, err
+	}
+	return s.GetPolicy(id)
+}
+
+func (s *EscalationService) DeletePolicy(id string) error {
+	_, err := s.PG.Exec(`UPDATE escalation_policies SET is_active = false, is_default = false, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// Policy resolution
+
+// FindPolicyForAlert returns the escalation policy for an alert. A policy
+// attached to the uptime service wins, then the policy of the alert's team,
+// then a policy listing the alert source, then the default policy. An empty
+// ID means no policy applies.
+func (s *EscalationService) FindPolicyForAlert(source, serviceID, teamID string) (string, error) {
+	var policyID string
+
+	if serviceID != "" {
+		err := s.PG.QueryRow(`
+			SELECT p.id FROM services svc
+			JOIN escalation_policies p ON p.id = svc.escalation_policy_id
+			WHERE svc.id = $1 AND p.is_active = true
+		`, serviceID).Scan(&policyID)
+		if err == nil {
+			return policyID, nil
+		} else if err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+
+	if teamID != "" {
+		err := s.PG.QueryRow(`
+			SELECT p.id FROM teams t
+			JOIN escalation_policies p ON p.id = t.escalation_policy_id
+			WHERE t.id = $1 AND p.is_active = true
+		`, teamID).Scan(&policyID)
+		if err == nil {
+			return policyID, nil
+		} else if err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+
+	err := s.PG.QueryRow(`
+		SELECT id FROM escalation_policies
+		WHERE is_active = true AND ($1 = ANY(sources) OR is_default = true)
+		ORDER BY ($1 = ANY(sources)) DESC, created_at
+		LIMIT 1
+	`, source).Scan(&policyID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return policyID, err
+}
+
+// GetLevel returns a single level of a policy. sql.ErrNoRows means the policy
+// has no such level, i.e. the escalation chain is exhausted. Alerts without a
+// policy get DefaultEscalationLevel.
+func (s *EscalationService) GetLevel(policyID string, levelNumber int) (db.EscalationLevel, error) {
+	var l db.EscalationLevel
+	if policyID == "" {
+		if levelNumber == 1 {
+			return DefaultEscalationLevel, nil
+		}
+		return l, sql.ErrNoRows
+	}
+
+	err := s.PG.QueryRow(`
+		SELECT id, policy_id, level_number, delay_minutes, target_type, target_id, repeat_count
+		FROM escalation_levels
+		WHERE policy_id = $1 AND level_number = $2
+	`, policyID, levelNumber).Scan(&l.ID, &l.PolicyID, &l.LevelNumber, &l.DelayMinutes, &l.TargetType, &l.TargetID, &l.RepeatCount)
+	return l, err
+}
+
+// ResolveTargets expands a level target into the users that should be notified.
+// Schedule targets without a rotation page the on-call of the alert's team,
+// or the default on-call when the alert has no team.
+func (s *EscalationService) ResolveTargets(level db.EscalationLevel, teamID string) ([]db.User, error) {
+	userService := NewUserService(s.PG, s.Redis)
+
+	switch level.TargetType {
+	case db.EscalationTargetUser:
+		user, err := userService.GetUser(level.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.IsActive {
+			return nil, nil
+		}
+		return []db.User{user}, nil
+	case db.EscalationTargetSchedule:
+		// target_id picks a rotation, empty means the team or default on-call
+		var user db.User
+		var err error
+		if level.TargetID != "" {
+			user, err = userService.GetRotationOnCallUser(level.TargetID)
+		} else if teamID != "" {
+			user, err = userService.GetTeamOnCallUser(teamID)
+		} else {
+			user, err = userService.GetCurrentOnCallUser()
+		}
+		if err == sql.ErrNoRows {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return []db.User{user}, nil
+	case db.EscalationTargetTeam:
+		return s.listTeamUsers(level.TargetID)
+	default:
+		return nil, errors.New("unknown escalation target type: " + level.TargetType)
+	}
+}
+
+// Helper functions
+
+func (s *EscalationService) listLevels(policyID string) ([]db.EscalationLevel, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, policy_id, level_number, delay_minutes, target_type, target_id, repeat_count
+		FROM escalation_levels
+		WHERE policy_id = $1
+		ORDER BY level_number
+	`, policyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []db.EscalationLevel{}
+	for rows.Next() {
+		var l db.EscalationLevel
+		err := rows.Scan(&l.ID, &l.PolicyID, &l.LevelNumber, &l.DelayMinutes, &l.TargetType, &l.TargetID, &l.RepeatCount)
+		if err != nil {
+			continue
+		}
+		levels = append(levels, l)
+	}
+	return levels, nil
+}
+
+func (s *EscalationService) insertLevels(tx *sql.Tx, policyID string, reqs []db.EscalationLevelRequest) ([]db.EscalationLevel, error) {
+	levels := make([]db.EscalationLevel, 0, len(reqs))
+	for i, req := range reqs {
+		if req.TargetType != db.EscalationTargetSchedule && req.TargetID == "" {
+			return nil, errors.New("target_id is required for user and team targets")
+		}
+
+		level := db.EscalationLevel{
+			ID:           uuid.New().String(),
+			PolicyID:     policyID,
+			LevelNumber:  i + 1,
+			DelayMinutes: req.DelayMinutes,
+			TargetType:   req.TargetType,
+			TargetID:     req.TargetID,
+			RepeatCount:  req.RepeatCount,
+		}
+
+		_, err := tx.Exec(`INSERT INTO escalation_levels (id, policy_id, level_number, delay_minutes, target_type, target_id, repeat_count) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+			level.ID, level.PolicyID, level.LevelNumber, level.DelayMinutes, level.TargetType, level.TargetID, level.RepeatCount)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// listTeamUsers accepts a team ID or, for levels created before teams
+// existed, a team name
+func (s *EscalationService) listTeamUsers(team string) ([]db.User, error) {
+	rows, err := s.PG.Query(`SELECT id, name, email, COALESCE(phone, '') as phone, role, team, COALESCE(fcm_token, '') as fcm_token, is_active, created_at, updated_at FROM users WHERE (team = $1 OR team = (SELECT name FROM teams WHERE id = $1)) AND is_active = true ORDER BY name`, team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []db.User
+	for rows.Next() {
+		var u db.User
+		err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.Role, &u.Team, &u.FCMToken, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+var ErrMaintenanceWindowNotFound = errors.New("maintenance window not found")
+
+type MaintenanceService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewMaintenanceService(pg *sql.DB, redis *redis.Client) *MaintenanceService {
+	return &MaintenanceService{PG: pg, Redis: redis}
+}
+
+const maintenanceWindowSelect = `
+	SELECT id, name, COALESCE(description, ''), service_ids, sources, labels, starts_at, ends_at, recurrence, time_zone,
+		is_active, COALESCE(created_by, ''), created_at, updated_at
+	FROM maintenance_windows
+`
+
+// Days between the occurrences of a recurring window
+var maintenanceRecurrenceDays = map[string]int{
+	db.MaintenanceDaily:  1,
+	db.MaintenanceWeekly: 7,
+}
+
+// Maintenance window CRUD operations
+func (s *MaintenanceService) ListWindows() ([]db.MaintenanceWindow, error) {
+	return s.queryWindows(maintenanceWindowSelect+`WHERE is_active = true ORDER BY starts_at`, time.Now())
+}
+
+func (s *MaintenanceService) GetWindow(id string) (db.MaintenanceWindow, error) {
+	windows, err := s.queryWindows(maintenanceWindowSelect+`WHERE id = $1`, time.Now(), id)
+	if err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+	if len(windows) == 0 {
+		return db.MaintenanceWindow{}, ErrMaintenanceWindowNotFound
+	}
+	return windows[0], nil
+}
+
+func (s *MaintenanceService) CreateWindow(actorID string, c *gin.Context) (db.MaintenanceWindow, error) {
+	var req db.MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+	if err := s.validateWindow(&req); err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+
+	window := db.MaintenanceWindow{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		ServiceIDs:  req.ServiceIDs,
+		Sources:     req.Sources,
+		Labels:      req.Labels,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Recurrence:  req.Recurrence,
+		TimeZone:    req.TimeZone,
+		IsActive:    true,
+		CreatedBy:   actorID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	window.InProgress = windowInProgress(window, time.Now())
+	labels, err := json.Marshal(window.Labels)
+	if err != nil {
+		return window, err
+	}
+
+	_, err = s.PG.Exec(`INSERT INTO maintenance_windows (id, name, description, service_ids, sources, labels, starts_at, ends_at, recurrence, time_zone, is_active, created_by, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`,
+		window.ID, window.Name, window.Description, pq.Array(window.ServiceIDs), pq.Array(window.Sources), string(labels), window.StartsAt, window.EndsAt,
+		window.Recurrence, window.TimeZone, window.IsActive, nullString(window.CreatedBy), window.CreatedAt, window.UpdatedAt)
+	return window, err
+}
+
+func (s *MaintenanceService) UpdateWindow(id string, c *gin.Context) (db.MaintenanceWindow, error) {
+	var req db.MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+	if err := s.validateWindow(&req); err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+	labels, err := json.Marshal(req.Labels)
+	if err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+
+	result, err := s.PG.Exec(`UPDATE maintenance_windows SET name=$2, description=$3, service_ids=$4, sources=$5, labels=$6, starts_at=$7, ends_at=$8, recurrence=$9, time_zone=$10, updated_at=$11 WHERE id=$1 AND is_active = true`,
+		id, req.Name, req.Description, pq.Array(req.ServiceIDs), pq.Array(req.Sources), string(labels), req.StartsAt, req.EndsAt, req.Recurrence, req.TimeZone, time.Now())
+	if err != nil {
+		return db.MaintenanceWindow{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return db.MaintenanceWindow{}, ErrMaintenanceWindowNotFound
+	}
+	return s.GetWindow(id)
+}
+
+// DeleteWindow ends a window early; alerts it suppressed stay suppressed
+func (s *MaintenanceService) DeleteWindow(id string) error {
+	_, err := s.PG.Exec(`UPDATE maintenance_windows SET is_active = false, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// ActiveWindow returns the first window in progress at the given time that
+// covers an alert of the source with the route's uptime service and labels
+func (s *MaintenanceService) ActiveWindow(source string, route AlertRoute, at time.Time) (db.MaintenanceWindow, bool, error) {
+	windows, err := s.queryWindows(maintenanceWindowSelect+`WHERE is_active = true AND starts_at <= $1 AND (recurrence <> '' OR ends_at > $1) ORDER BY created_at`,
+		at, at.UTC())
+	if err != nil {
+		return db.MaintenanceWindow{}, false, err
+	}
+	for _, window := range windows {
+		if window.InProgress && maintenanceWindowMatches(window, source, route) {
+			return window, true, nil
+		}
+	}
+	return db.MaintenanceWindow{}, false, nil
+}
+
+// Helper functions
+
+// windowInProgress checks whether an occurrence of the window covers the
+// given time
+func windowInProgress(window db.MaintenanceWindow, at time.Time) bool {
+	if at.Before(window.StartsAt) {
+		return false
+	}
+	days := maintenanceRecurrenceDays[window.Recurrence]
+	if days == 0 {
+		return at.Before(window.EndsAt)
+	}
+
+	loc, err := time.LoadLocation(window.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start, length := window.StartsAt.In(loc), window.EndsAt.Sub(window.StartsAt)
+
+	// Occurrences keep their wall-clock time, so across a DST change the
+	// one covering the time may be a neighbour of the plain multiple
+	n := int(at.Sub(start) / (time.Duration(days) * 24 * time.Hour))
+	for k := max(n-1, 0); k <= n+1; k++ {
+		occurrence := start.AddDate(0, 0, k*days)
+		if !at.Before(occurrence) && at.Before(occurrence.Add(length)) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceWindowMatches checks every scope the window sets
+func maintenanceWindowMatches(window db.MaintenanceWindow, source string, route AlertRoute) bool {
+	if len(window.ServiceIDs) > 0 && !slices.Contains(window.ServiceIDs, route.ServiceID) {
+		return false
+	}
+	if len(window.Sources) > 0 && !slices.Contains(window.Sources, source) {
+		return false
+	}
+	for key, value := range window.Labels {
+		if route.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MaintenanceService) validateWindow(req *db.MaintenanceWindowRequest) error {
+	if len(req.ServiceIDs) == 0 && len(req.Sources) == 0 && len(req.Labels) == 0 {
+		return errors.New("a maintenance window needs service_ids, sources or labels")
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if days := maintenanceRecurrenceDays[req.Recurrence]; days > 0 && req.EndsAt.Sub(req.StartsAt) >= time.Duration(days)*24*time.Hour {
+		return fmt.Errorf("a %s window must be shorter than its period", req.Recurrence)
+	}
+	if req.TimeZone == "" {
+		req.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.TimeZone); err != nil {
+		return fmt.Errorf("invalid time_zone %q", req.TimeZone)
+	}
+
+	if len(req.ServiceIDs) > 0 {
+		var found int
+		if err := s.PG.QueryRow(`SELECT COUNT(*) FROM services WHERE id = ANY($1)`, pq.Array(req.ServiceIDs)).Scan(&found); err != nil {
+			return err
+		}
+		if found != len(slices.Compact(slices.Sorted(slices.Values(req.ServiceIDs)))) {
+			return errors.New("unknown uptime service in service_ids")
+		}
+	}
+
+	req.StartsAt, req.EndsAt = req.StartsAt.UTC(), req.EndsAt.UTC()
+	if req.ServiceIDs == nil {
+		req.ServiceIDs = []string{}
+	}
+	if req.Sources == nil {
+		req.Sources = []string{}
+	}
+	if req.Labels == nil {
+		req.Labels = map[string]string{}
+	}
+	return nil
+}
+
+func (s *MaintenanceService) queryWindows(query string, at time.Time, args ...interface{}) ([]db.MaintenanceWindow, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []db.MaintenanceWindow{}
+	for rows.Next() {
+		var w db.MaintenanceWindow
+		var serviceIDs, sources pq.StringArray
+		var labels []byte
+		err := rows.Scan(&w.ID, &w.Name, &w.Description, &serviceIDs, &sources, &labels, &w.StartsAt, &w.EndsAt, &w.Recurrence, &w.TimeZone,
+			&w.IsActive, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		w.ServiceIDs, w.Sources, w.Labels = append([]string{}, serviceIDs...), append([]string{}, sources...), map[string]string{}
+		if err := json.Unmarshal(labels, &w.Labels); err != nil {
+			continue
+		}
+		w.StartsAt, w.EndsAt = w.StartsAt.UTC(), w.EndsAt.UTC()
+		w.InProgress = windowInProgress(w, at)
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+	"github.com/vanchonlee/oncallkit/notifier"
+)
+
+// Delivery retry settings. A failed send is retried after 30s, 1m, 2m, 4m;
+// after maxDeliveryAttempts it lands in the dead-letter list.
+const (
+	maxDeliveryAttempts = 5
+	retryBaseDelay      = 30 * time.Second
+	retryMaxDelay       = 10 * time.Minute
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+type NotificationService struct {
+	PG         *sql.DB
+	Redis      *redis.Client
+	Dispatcher *notifier.Dispatcher
+}
+
+func NewNotificationService(pg *sql.DB, redis *redis.Client, dispatcher *notifier.Dispatcher) *NotificationService {
+	return &NotificationService{PG: pg, Redis: redis, Dispatcher: dispatcher}
+}
+
+// NotifyUser pages a user about an alert. The user's notification rules
+// decide the channels; rules with a delay are scheduled and only fire if the
+// alert is still open by then. Users without rules get the default channels.
+func (s *NotificationService) NotifyUser(alert db.Alert, user db.User, level int) []db.Notification {
+	ruleService := NewNotificationRuleService(s.PG, s.Redis, s.Dispatcher)
+	rules, err := ruleService.ActiveRulesForUser(user.ID)
+	if err != nil {
+		log.Printf("Notification: failed to load rules for user %s, using defaults: %v", user.ID, err)
+	}
+
+	if len(rules) == 0 {
+		recipient := UserRecipient(user)
+
+		var notifications []db.Notification
+		for _, channel := range s.defaultChannels(user, alert.Severity) {
+			notifications = append(notifications, s.deliver(alert, user.ID, "", channel, recipient, level, 1))
+		}
+		return notifications
+	}
+
+	scheduler := NewJobScheduler(s.Redis)
+	var notifications []db.Notification
+	for _, rule := range rules {
+		if !RuleMatches(rule, alert.Severity) {
+			continue
+		}
+
+		if rule.DelayMinutes == 0 {
+			if n, ok := s.NotifyRule(alert, user, rule, level); ok {
+				notifications = append(notifications, n)
+			}
+			continue
+		}
+
+		job := ScheduledJob{
+			ID:      NotificationRuleJobID(alert.ID, rule.ID),
+			Type:    JobTypeNotificationRule,
+			AlertID: alert.ID,
+			Level:   level,
+			UserID:  user.ID,
+			RuleID:  rule.ID,
+			DueAt:   time.Now().Add(time.Duration(rule.DelayMinutes) * time.Minute),
+		}
+		if err := scheduler.Schedule(context.Background(), job); err != nil {
+			log.Printf("Notification: failed to schedule %s rule %s for alert %s: %v", rule.Channel, rule.ID, alert.ID, err)
+		}
+	}
+	return notifications
+}
+
+// NotifyRule delivers an alert through a single notification rule
+func (s *NotificationService) NotifyRule(alert db.Alert, user db.User, rule db.NotificationRule, level int) (db.Notification, bool) {
+	ruleService := NewNotificationRuleService(s.PG, s.Redis, s.Dispatcher)
+	recipient, err := ruleService.RuleRecipient(user, rule)
+	if err != nil {
+		log.Printf("Notification: skipping %s rule %s for user %s: %v", rule.Channel, rule.ID, user.ID, err)
+		return db.Notification{}, false
+	}
+
+	return s.deliver(alert, user.ID, rule.ID, rule.Channel, recipient, level, 1), true
+}
+
+// NotifyBroadcast posts an alert to the shared webhook and chat channels
+func (s *NotificationService) NotifyBroadcast(alert db.Alert, level int) []db.Notification {
+	var notifications []db.Notification
+	for _, channel := range []string{notifier.ChannelWebhook, notifier.ChannelChat} {
+		if !s.Dispatcher.HasChannel(channel) {
+			continue
+		}
+		notifications = append(notifications, s.deliver(alert, "", "", channel, notifier.Recipient{}, level, 1))
+	}
+	return notifications
+}
+
+// Redeliver sends a page again, looking up the recipient from the user and
+// notification rule so that retries pick up changed contact details
+func (s *NotificationService) Redeliver(alert db.Alert, userID, ruleID, channel string, level, attempt int) (db.Notification, error) {
+	recipient := notifier.Recipient{}
+	if userID != "" {
+		user, err := NewUserService(s.PG, s.Redis).GetUser(userID)
+		if err != nil {
+			return db.Notification{}, err
+		}
+		recipient = UserRecipient(user)
+
+		if ruleID != "" {
+			ruleService := NewNotificationRuleService(s.PG, s.Redis, s.Dispatcher)
+			rule, err := ruleService.GetRule(userID, ruleID)
+			if err != nil {
+				return db.Notification{}, err
+			}
+			if recipient, err = ruleService.RuleRecipient(user, rule); err != nil {
+				return db.Notification{}, err
+			}
+		}
+	}
+
+	return s.deliver(alert, userID, ruleID, channel, recipient, level, attempt), nil
+}
+
+// Delivery log operations
+
+// ListAlertNotifications returns every delivery attempt made for an alert
+func (s *NotificationService) ListAlertNotifications(alertID string) ([]db.Notification, error) {
+	return s.queryNotifications(`
+		SELECT id, alert_id, COALESCE(user_id, ''), COALESCE(rule_id, ''), channel, target, escalation_level, attempt, status, COALESCE(provider_response, ''), COALESCE(error, ''), latency_ms, created_at
+		FROM notifications
+		WHERE alert_id = $1
+		ORDER BY created_at
+	`, alertID)
+}
+
+// ListDeadLetters returns the deliveries that ran out of retries
+func (s *NotificationService) ListDeadLetters() ([]db.Notification, error) {
+	return s.queryNotifications(`
+		SELECT id, alert_id, COALESCE(user_id, ''), COALESCE(rule_id, ''), channel, target, escalation_level, attempt, status, COALESCE(provider_response, ''), COALESCE(error, ''), latency_ms, created_at
+		FROM notifications
+		WHERE status = $1
+		ORDER BY created_at DESC
+	`, db.NotificationStatusDead)
+}
+
+// ReplayDeadLetter takes a delivery off the dead-letter list and sends it
+// again with a fresh set of retries. The delivery goes back on the list
+// unless the new attempt was accepted by the provider.
+func (s *NotificationService) ReplayDeadLetter(id, actorID string) (db.Notification, error) {
+	// Claiming the row first keeps a concurrent replay from sending it twice
+	var dead db.Notification
+	err := s.PG.QueryRow(`
+		UPDATE notifications SET status = $2
+		WHERE id = $1 AND status = $3
+		RETURNING alert_id, COALESCE(user_id, ''), COALESCE(rule_id, ''), channel, escalation_level
+	`, id, db.NotificationStatusReplayed, db.NotificationStatusDead).Scan(&dead.AlertID, &dead.UserID, &dead.RuleID, &dead.Channel, &dead.EscalationLevel)
+	if err == sql.ErrNoRows {
+		return dead, ErrDeadLetterNotFound
+	} else if err != nil {
+		return dead, err
+	}
+
+	replay, err := s.replay(dead)
+	if err != nil || replay.Status != db.NotificationStatusSent {
+		if _, restoreErr := s.PG.Exec(`UPDATE notifications SET status = $2 WHERE id = $1`, id, db.NotificationStatusDead); restoreErr != nil {
+			log.Printf("Notification: failed to put dead letter %s back: %v", id, restoreErr)
+		}
+		if err != nil {
+			return replay, err
+		}
+	}
+
+	event := userEvent(dead.AlertID, db.AlertEventNotificationReplay, actorID)
+	event.OldValue, event.NewValue = id, dead.Channel
+	if err := NewAlertEventService(s.PG, s.Redis).Record(s.PG, event); err != nil {
+		return replay, err
+	}
+	return replay, nil
+}
+
+// defaultChannels picks the channels used when a user has no preferences:
+// push and email always, SMS only for critical alerts
+func (s *NotificationService) defaultChannels(user db.User, severity string) []string {
+	var channels []string
+	if user.FCMToken != "" {
+		channels = append(channels, notifier.ChannelPush)
+	}
+	if user.Email != "" {
+		channels = append(channels, notifier.ChannelEmail)
+	}
+	if user.Phone != "" && severity == "critical" {
+		channels = append(channels, notifier.ChannelSMS)
+	}
+
+	enabled := channels[:0]
+	for _, channel := range channels {
+		if s.Dispatcher.HasChannel(channel) {
+			enabled = append(enabled, channel)
+		}
+	}
+	return enabled
+}
+
+// Helper functions
+
+// replay sends a dead letter again to the same user, rule and channel
+func (s *NotificationService) replay(dead db.Notification) (db.Notification, error) {
+	current, err := NewAlertService(s.PG, s.Redis).GetAlert(dead.AlertID)
+	if err != nil {
+		return db.Notification{}, err
+	}
+	return s.Redeliver(AlertFromResponse(current), dead.UserID, dead.RuleID, dead.Channel, dead.EscalationLevel, 1)
+}
+
+// deliver sends one message, records the attempt and schedules a retry with
+// exponential backoff if it failed
+func (s *NotificationService) deliver(alert db.Alert, userID, ruleID, channel string, recipient notifier.Recipient, level, attempt int) db.Notification {
+	d := s.Dispatcher.Send(context.Background(), channel, recipient, AlertMessage(alert, level))
+	logDelivery(alert.ID, recipient.UserID, d)
+
+	n := db.Notification{
+		ID:               uuid.New().String(),
+		AlertID:          alert.ID,
+		UserID:           userID,
+		RuleID:           ruleID,
+		Channel:          channel,
+		Target:           deliveryTarget(channel, recipient),
+		EscalationLevel:  level,
+		Attempt:          attempt,
+		Status:           db.NotificationStatusSent,
+		ProviderResponse: d.Result.Response,
+		LatencyMs:        d.Latency.Milliseconds(),
+		CreatedAt:        time.Now(),
+	}
+	if n.ProviderResponse == "" {
+		n.ProviderResponse = d.Result.MessageID
+	}
+
+	if d.Err != nil {
+		n.Error = d.Err.Error()
+		n.Status = db.NotificationStatusDead
+
+		// A missing address or provider will not fix itself, dead-letter it
+		// right away so it can be replayed once the config is fixed
+		retryable := !errors.Is(d.Err, notifier.ErrNoAddress) && !errors.Is(d.Err, notifier.ErrUnknownChannel)
+		if retryable && attempt < maxDeliveryAttempts {
+			job := ScheduledJob{
+				ID:      NotificationRetryJobID(n.ID),
+				Type:    JobTypeNotificationRetry,
+				AlertID: alert.ID,
+				Level:   level,
+				Attempt: attempt + 1,
+				UserID:  userID,
+				RuleID:  ruleID,
+				Channel: channel,
+				DueAt:   time.Now().Add(retryDelay(attempt)),
+			}
+			if err := NewJobScheduler(s.Redis).Schedule(context.Background(), job); err != nil {
+				log.Printf("Notification: failed to schedule retry of %s for alert %s: %v", channel, alert.ID, err)
+			} else {
+				n.Status = db.NotificationStatusFailed
+			}
+		}
+		if n.Status == db.NotificationStatusDead {
+			log.Printf("Notification: %s for alert %s moved to dead-letter list after %d attempts", channel, alert.ID, attempt)
+		}
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO notifications (id, alert_id, user_id, rule_id, channel, target, escalation_level, attempt, status, provider_response, error, latency_ms, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`,
+		n.ID, n.AlertID, nullString(n.UserID), nullString(n.RuleID), n.Channel, n.Target, n.EscalationLevel, n.Attempt, n.Status, n.ProviderResponse, n.Error, n.LatencyMs, n.CreatedAt)
+	if err != nil {
+		log.Printf("Notification: failed to record %s delivery for alert %s: %v", channel, alert.ID, err)
+	}
+
+	event := db.AlertEvent{AlertID: alert.ID, Action: db.AlertEventNotified, NewValue: n.Status, Message: channel + " to " + n.Target}
+	if n.Error != "" {
+		event.Message += ": " + n.Error
+	}
+	if err := NewAlertEventService(s.PG, s.Redis).Record(s.PG, event); err != nil {
+		log.Printf("Notification: failed to record timeline event for alert %s: %v", alert.ID, err)
+	}
+	return n
+}
+
+func (s *NotificationService) queryNotifications(query string, args ...interface{}) ([]db.Notification, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []db.Notification{}
+	for rows.Next() {
+		var n db.Notification
+		err := rows.Scan(&n.ID, &n.AlertID, &n.UserID, &n.RuleID, &n.Channel, &n.Target, &n.EscalationLevel, &n.Attempt, &n.Status, &n.ProviderResponse, &n.Error, &n.LatencyMs, &n.CreatedAt)
+		if err != nil {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+// retryDelay is the backoff before the attempt after the given one
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// deliveryTarget describes where a message went, without leaking device tokens
+func deliveryTarget(channel string, recipient notifier.Recipient) string {
+	if channel == notifier.ChannelPush {
+		if len(recipient.FCMToken) > 8 {
+			return "fcm:..." + recipient.FCMToken[len(recipient.FCMToken)-8:]
+		}
+		return "fcm"
+	}
+	if recipient.Address != "" {
+		return recipient.Address
+	}
+	switch channel {
+	case notifier.ChannelEmail:
+		return recipient.Email
+	case notifier.ChannelSMS, notifier.ChannelVoice:
+		return recipient.Phone
+	default:
+		return channel
+	}
+}
+
+// AlertFromResponse converts a loaded alert into the shape used for paging
+func AlertFromResponse(a db.AlertResponse) db.Alert {
+	return db.Alert{
+		ID:                 a.ID,
+		Title:              a.Title,
+		Description:        a.Description,
+		Status:             a.Status,
+		Severity:           a.Severity,
+		Source:             a.Source,
+		EscalationPolicyID: a.EscalationPolicyID,
+		EscalationLevel:    a.EscalationLevel,
+		TeamID:             a.TeamID,
+		DedupKey:           a.DedupKey,
+		Count:              a.Count,
+		Author:             a.Author,
+		Tags:               a.Tags,
+		Details:            a.Details,
+		ParentID:           a.ParentID,
+	}
+}
+
+// AlertMessage builds the channel independent notification for an alert
+func AlertMessage(alert db.Alert, level int) notifier.Message {
+	return notifier.Message{
+		AlertID:     alert.ID,
+		Title:       alert.Title,
+		Description: alert.Description,
+		Severity:    alert.Severity,
+		Source:      alert.Source,
+		Status:      alert.Status,
+		Level:       level,
+	}
+}
+
+// UserRecipient maps a user's contact details to a notifier recipient
+func UserRecipient(user db.User) notifier.Recipient {
+	return notifier.Recipient{
+		UserID:   user.ID,
+		Name:     user.Name,
+		Email:    user.Email,
+		Phone:    user.Phone,
+		FCMToken: user.FCMToken,
+	}
+}
+
+func logDelivery(alertID, target string, d notifier.Delivery) {
+	if d.Err != nil {
+		log.Printf("Notification: %s to %s for alert %s failed after %v: %v", d.Channel, target, alertID, d.Latency, d.Err)
+		return
+	}
+	log.Printf("Notification: %s to %s for alert %s delivered in %v", d.Channel, target, alertID, d.Latency)
+}
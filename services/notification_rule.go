@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vanchonlee/oncallkit/db"
+	"github.com/vanchonlee/oncallkit/notifier"
+)
+
+// How long a contact method verification code stays valid, and how many
+// wrong guesses it takes before it is thrown away
+const (
+	verificationCodeTTL     = 15 * time.Minute
+	maxVerificationAttempts = 5
+)
+
+var (
+	ErrContactMethodNotFound = errors.New("contact method not found")
+	ErrInvalidVerification   = errors.New("invalid or expired verification code")
+	ErrRuleNotFound          = errors.New("notification rule not found")
+)
+
+type NotificationRuleService struct {
+	PG         *sql.DB
+	Redis      *redis.Client
+	Dispatcher *notifier.Dispatcher
+}
+
+func NewNotificationRuleService(pg *sql.DB, redis *redis.Client, dispatcher *notifier.Dispatcher) *NotificationRuleService {
+	return &NotificationRuleService{PG: pg, Redis: redis, Dispatcher: dispatcher}
+}
+
+// Contact method operations
+func (s *NotificationRuleService) ListContactMethods(userID string) ([]db.ContactMethod, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, user_id, type, address, is_verified, verified_at, created_at
+		FROM user_contact_methods
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	methods := []db.ContactMethod{}
+	for rows.Next() {
+		var m db.ContactMethod
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Type, &m.Address, &m.IsVerified, &verifiedAt, &m.CreatedAt); err != nil {
+			continue
+		}
+		if verifiedAt.Valid {
+			m.VerifiedAt = &verifiedAt.Time
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+func (s *NotificationRuleService) GetContactMethod(userID, methodID string) (db.ContactMethod, error) {
+	var m db.ContactMethod
+	var verifiedAt sql.NullTime
+	err := s.PG.QueryRow(`
+		SELECT id, user_id, type, address, is_verified, verified_at, created_at
+		FROM user_contact_methods
+		WHERE id = $1 AND user_id = $2
+	`, methodID, userID).Scan(&m.ID, &m.UserID, &m.Type, &m.Address, &m.IsVerified, &verifiedAt, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return m, ErrContactMethodNotFound
+	}
+	if verifiedAt.Valid {
+		m.VerifiedAt = &verifiedAt.Time
+	}
+	return m, err
+}
+
+// CreateContactMethod stores an unverified contact method and sends it a
+// verification code
+func (s *NotificationRuleService) CreateContactMethod(userID string, c *gin.Context) (db.ContactMethod, error) {
+	var req db.ContactMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.ContactMethod{}, err
+	}
+
+	method := db.ContactMethod{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      req.Type,
+		Address:   req.Address,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO user_contact_methods (id, user_id, type, address, is_verified, created_at) VALUES ($1,$2,$3,$4,$5,$6)`,
+		method.ID, method.UserID, method.Type, method.Address, method.IsVerified, method.CreatedAt)
+	if err != nil {
+		return method, err
+	}
+
+	if err := s.SendVerification(userID, method.ID); err != nil {
+		return method, fmt.Errorf("contact method created but verification could not be sent: %w", err)
+	}
+	return method, nil
+}
+
+// SendVerification sends a fresh one-time code to the contact method
+func (s *NotificationRuleService) SendVerification(userID, methodID string) error {
+	method, err := s.GetContactMethod(userID, methodID)
+	if err != nil {
+		return err
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	_, err = s.Redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), verificationKey(method.ID), code, verificationCodeTTL)
+		pipe.Del(context.Background(), verificationAttemptsKey(method.ID))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := notifier.Message{
+		Title:       "SLAR verification code",
+		Description: fmt.Sprintf("Your SLAR verification code is %s", code),
+	}
+	delivery := s.Dispatcher.Send(context.Background(), method.Type, contactRecipient(notifier.Recipient{UserID: userID}, method), msg)
+	return delivery.Err
+}
+
+func (s *NotificationRuleService) VerifyContactMethod(userID, methodID, code string) (db.ContactMethod, error) {
+	method, err := s.GetContactMethod(userID, methodID)
+	if err != nil {
+		return method, err
+	}
+
+	ctx, key := context.Background(), verificationKey(method.ID)
+	expected, err := s.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return method, ErrInvalidVerification
+	} else if err != nil {
+		return method, err
+	}
+
+	// Every guess counts, the code is dropped once too many were wrong
+	attempts, err := s.Redis.Incr(ctx, verificationAttemptsKey(method.ID)).Result()
+	if err != nil {
+		return method, err
+	}
+	if attempts == 1 {
+		s.Redis.Expire(ctx, verificationAttemptsKey(method.ID), verificationCodeTTL)
+	}
+	if attempts > maxVerificationAttempts {
+		s.Redis.Del(ctx, key, verificationAttemptsKey(method.ID))
+		return method, ErrInvalidVerification
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+		if attempts == maxVerificationAttempts {
+			s.Redis.Del(ctx, key, verificationAttemptsKey(method.ID))
+		}
+		return method, ErrInvalidVerification
+	}
+
+	now := time.Now()
+	_, err = s.PG.Exec(`UPDATE user_contact_methods SET is_verified = true, verified_at = $1 WHERE id = $2`, now, method.ID)
+	if err != nil {
+		return method, err
+	}
+	s.Redis.Del(ctx, key, verificationAttemptsKey(method.ID))
+
+	method.IsVerified = true
+	method.VerifiedAt = &now
+	return method, nil
+}
+
+func (s *NotificationRuleService) DeleteContactMethod(userID, methodID string) error {
+	result, err := s.PG.Exec(`DELETE FROM user_contact_methods WHERE id = $1 AND user_id = $2`, methodID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrContactMethodNotFound
+	}
+	return nil
+}
+
+// Notification rule operations
+func (s *NotificationRuleService) ListRules(userID string) ([]db.NotificationRule, error) {
+	return s.queryRules(`
+		SELECT id, user_id, channel, COALESCE(contact_method_id, ''), delay_minutes, COALESCE(severities, '{}'), is_active, created_at, updated_at
+		FROM user_notification_rules
+		WHERE user_id = $1
+		ORDER BY delay_minutes, channel
+	`, userID)
+}
+
+// ActiveRulesForUser returns the rules the worker evaluates when paging a user
+func (s *NotificationRuleService) ActiveRulesForUser(userID string) ([]db.NotificationRule, error) {
+	return s.queryRules(`
+		SELECT id, user_id, channel, COALESCE(contact_method_id, ''), delay_minutes, COALESCE(severities, '{}'), is_active, created_at, updated_at
+		FROM user_notification_rules
+		WHERE user_id = $1 AND is_active = true
+		ORDER BY delay_minutes, channel
+	`, userID)
+}
+
+func (s *NotificationRuleService) GetRule(userID, ruleID string) (db.NotificationRule, error) {
+	rules, err := s.queryRules(`
+		SELECT id, user_id, channel, COALESCE(contact_method_id, ''), delay_minutes, COALESCE(severities, '{}'), is_active, created_at, updated_at
+		FROM user_notification_rules
+		WHERE id = $1 AND user_id = $2
+	`, ruleID, userID)
+	if err != nil {
+		return db.NotificationRule{}, err
+	}
+	if len(rules) == 0 {
+		return db.NotificationRule{}, ErrRuleNotFound
+	}
+	return rules[0], nil
+}
+
+func (s *NotificationRuleService) CreateRule(userID string, c *gin.Context) (db.NotificationRule, error) {
+	var req db.NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.NotificationRule{}, err
+	}
+	if err := s.validateRule(userID, &req); err != nil {
+		return db.NotificationRule{}, err
+	}
+
+	rule := db.NotificationRule{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		Channel:         req.Channel,
+		ContactMethodID: req.ContactMethodID,
+		DelayMinutes:    req.DelayMinutes,
+		Severities:      req.Severities,
+		IsActive:        true,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO user_notification_rules (id, user_id, channel, contact_method_id, delay_minutes, severities, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		rule.ID, rule.UserID, rule.Channel, nullString(rule.ContactMethodID), rule.DelayMinutes, pq.Array(rule.Severities), rule.IsActive, rule.CreatedAt, rule.UpdatedAt)
+	return rule, err
+}
+
+func (s *NotificationRuleService) UpdateRule(userID, ruleID string, c *gin.Context) (db.NotificationRule, error) {
+	var req db.NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.NotificationRule{}, err
+	}
+	if err := s.validateRule(userID, &req); err != nil {
+		return db.NotificationRule{}, err
+	}
+
+	result, err := s.PG.Exec(`UPDATE user_notification_rules SET channel=$3, contact_method_id=$4, delay_minutes=$5, severities=$6, updated_at=$7 WHERE id=$1 AND user_id=$2`,
+		ruleID, userID, req.Channel, nullString(req.ContactMethodID), req.DelayMinutes, pq.Array(req.Severities), time.Now())
+	if err != nil {
+		return db.NotificationRule{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return db.NotificationRule{}, ErrRuleNotFound
+	}
+	return s.GetRule(userID, ruleID)
+}
+
+func (s *NotificationRuleService) DeleteRule(userID, ruleID string) error {
+	result, err := s.PG.Exec(`DELETE FROM user_notification_rules WHERE id = $1 AND user_id = $2`, ruleID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// RuleRecipient resolves where a rule delivers to. Rules bound to a contact
+// method only fire once that method is verified.
+func (s *NotificationRuleService) RuleRecipient(user db.User, rule db.NotificationRule) (notifier.Recipient, error) {
+	recipient := UserRecipient(user)
+	if rule.ContactMethodID == "" {
+		return recipient, nil
+	}
+
+	method, err := s.GetContactMethod(user.ID, rule.ContactMethodID)
+	if err != nil {
+		return recipient, err
+	}
+	if !method.IsVerified {
+		return recipient, fmt.Errorf("contact method %s is not verified", method.ID)
+	}
+	return contactRecipient(recipient, method), nil
+}
+
+// RuleMatches reports whether a rule applies to an alert severity
+func RuleMatches(rule db.NotificationRule, severity string) bool {
+	if len(rule.Severities) == 0 {
+		return true
+	}
+	for _, s := range rule.Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper functions
+
+func (s *NotificationRuleService) validateRule(userID string, req *db.NotificationRuleRequest) error {
+	if req.Severities == nil {
+		req.Severities = []string{}
+	}
+	if req.ContactMethodID == "" {
+		return nil
+	}
+
+	method, err := s.GetContactMethod(userID, req.ContactMethodID)
+	if err != nil {
+		return err
+	}
+	// SMS and voice share phone numbers
+	phone := func(t string) bool { return t == notifier.ChannelSMS || t == notifier.ChannelVoice }
+	if method.Type != req.Channel && !(phone(method.Type) && phone(req.Channel)) {
+		return fmt.Errorf("contact method %s cannot be used for %s", method.Type, req.Channel)
+	}
+	return nil
+}
+
+func (s *NotificationRuleService) queryRules(query string, args ...interface{}) ([]db.NotificationRule, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []db.NotificationRule{}
+	for rows.Next() {
+		var r db.NotificationRule
+		var severities pq.StringArray
+		err := rows.Scan(&r.ID, &r.UserID, &r.Channel, &r.ContactMethodID, &r.DelayMinutes, &severities, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		r.Severities = []string(severities)
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// verificationKey holds the pending verification code of a contact method
+func verificationKey(methodID string) string {
+	return "contact:verify:" + methodID
+}
+
+// verificationAttemptsKey counts the guesses made at that code
+func verificationAttemptsKey(methodID string) string {
+	return "contact:verify:attempts:" + methodID
+}
+
+// contactRecipient points a recipient at a specific contact method
+func contactRecipient(recipient notifier.Recipient, method db.ContactMethod) notifier.Recipient {
+	if method.Type == notifier.ChannelPush {
+		recipient.FCMToken = method.Address
+	} else {
+		recipient.Address = method.Address
+	}
+	return recipient
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+var (
+	ErrOverrideNotFound = errors.New("override not found")
+	ErrSwapNotFound     = errors.New("shift swap not found")
+	ErrSwapNotPending   = errors.New("shift swap is no longer pending")
+	ErrSwapForbidden    = errors.New("only the other engineer can answer this swap")
+)
+
+type OverrideService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewOverrideService(pg *sql.DB, redis *redis.Client) *OverrideService {
+	return &OverrideService{PG: pg, Redis: redis}
+}
+
+// Override operations
+
+// ListOverrides returns the active overrides of a rotation overlapping the range
+func (s *OverrideService) ListOverrides(rotationID string, from, to time.Time) ([]db.ScheduleOverride, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, rotation_id, user_id, start_time, end_time, COALESCE(reason, ''), COALESCE(swap_id, ''), created_by, created_at
+		FROM schedule_overrides
+		WHERE rotation_id = $1 AND cancelled_at IS NULL AND start_time < $3 AND end_time > $2
+		ORDER BY start_time, created_at
+	`, rotationID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []db.ScheduleOverride{}
+	for rows.Next() {
+		var o db.ScheduleOverride
+		err := rows.Scan(&o.ID, &o.RotationID, &o.UserID, &o.StartTime, &o.EndTime, &o.Reason, &o.SwapID, &o.CreatedBy, &o.CreatedAt)
+		if err != nil {
+			continue
+		}
+		o.StartTime, o.EndTime = o.StartTime.UTC(), o.EndTime.UTC()
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+func (s *OverrideService) CreateOverride(rotationID, actorID string, c *gin.Context) (db.ScheduleOverride, error) {
+	var req db.ScheduleOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.ScheduleOverride{}, err
+	}
+	if !req.EndTime.After(req.StartTime) {
+		return db.ScheduleOverride{}, errors.New("end_time must be after start_time")
+	}
+	if _, err := NewRotationService(s.PG, s.Redis).GetRotation(rotationID); err != nil {
+		return db.ScheduleOverride{}, err
+	}
+	if err := s.requireActiveUser(req.UserID); err != nil {
+		return db.ScheduleOverride{}, err
+	}
+
+	override := db.ScheduleOverride{
+		ID:         uuid.New().String(),
+		RotationID: rotationID,
+		UserID:     req.UserID,
+		StartTime:  req.StartTime.UTC(),
+		EndTime:    req.EndTime.UTC(),
+		Reason:     req.Reason,
+		CreatedBy:  actorID,
+		CreatedAt:  time.Now(),
+	}
+	return override, s.insertOverride(s.PG, override)
+}
+
+// CancelOverride removes an override from the schedule, keeping the record
+func (s *OverrideService) CancelOverride(rotationID, overrideID, actorID string) error {
+	result, err := s.PG.Exec(`UPDATE schedule_overrides SET cancelled_by = $3, cancelled_at = $4 WHERE id = $1 AND rotation_id = $2 AND cancelled_at IS NULL`,
+		overrideID, rotationID, actorID, time.Now())
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrOverrideNotFound
+	}
+	return nil
+}
+
+// Shift swap operations
+
+// ListSwaps returns the swaps a user proposed or was asked to take
+func (s *OverrideService) ListSwaps(userID string) ([]db.ShiftSwap, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, rotation_id, requester_id, target_user_id, start_time, end_time, swap_start_time, swap_end_time, COALESCE(reason, ''), status, COALESCE(responded_by, ''), responded_at, created_at
+		FROM shift_swaps
+		WHERE requester_id = $1 OR target_user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	swaps := []db.ShiftSwap{}
+	for rows.Next() {
+		swap, err := scanSwap(rows)
+		if err != nil {
+			continue
+		}
+		swaps = append(swaps, swap)
+	}
+	return swaps, nil
+}
+
+func (s *OverrideService) GetSwap(id string) (db.ShiftSwap, error) {
+	swap, err := scanSwap(s.PG.QueryRow(`
+		SELECT id, rotation_id, requester_id, target_user_id, start_time, end_time, swap_start_time, swap_end_time, COALESCE(reason, ''), status, COALESCE(responded_by, ''), responded_at, created_at
+		FROM shift_swaps
+		WHERE id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return swap, ErrSwapNotFound
+	}
+	return swap, err
+}
+
+// ProposeSwap asks another engineer to take over part of the requester's shift
+func (s *OverrideService) ProposeSwap(requesterID string, c *gin.Context) (db.ShiftSwap, error) {
+	var req db.ShiftSwapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.ShiftSwap{}, err
+	}
+	if !req.EndTime.After(req.StartTime) {
+		return db.ShiftSwap{}, errors.New("end_time must be after start_time")
+	}
+	if (req.SwapStartTime == nil) != (req.SwapEndTime == nil) {
+		return db.ShiftSwap{}, errors.New("swap_start_time and swap_end_time must be set together")
+	}
+	if req.SwapStartTime != nil && !req.SwapEndTime.After(*req.SwapStartTime) {
+		return db.ShiftSwap{}, errors.New("swap_end_time must be after swap_start_time")
+	}
+	if _, err := NewRotationService(s.PG, s.Redis).GetRotation(req.RotationID); err != nil {
+		return db.ShiftSwap{}, errors.New("rotation not found")
+	}
+	if req.TargetUserID == requesterID {
+		return db.ShiftSwap{}, errors.New("cannot swap with yourself")
+	}
+	if err := s.requireActiveUser(req.TargetUserID); err != nil {
+		return db.ShiftSwap{}, err
+	}
+
+	swap := db.ShiftSwap{
+		ID:            uuid.New().String(),
+		RotationID:    req.RotationID,
+		RequesterID:   requesterID,
+		TargetUserID:  req.TargetUserID,
+		StartTime:     req.StartTime,
+		EndTime:       req.EndTime,
+		SwapStartTime: req.SwapStartTime,
+		SwapEndTime:   req.SwapEndTime,
+		Reason:        req.Reason,
+		Status:        db.SwapStatusPending,
+		CreatedAt:     time.Now(),
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO shift_swaps (id, rotation_id, requester_id, target_user_id, start_time, end_time, swap_start_time, swap_end_time, reason, status, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
+		swap.ID, swap.RotationID, swap.RequesterID, swap.TargetUserID, swap.StartTime, swap.EndTime, swap.SwapStartTime, swap.SwapEndTime, swap.Reason, swap.Status, swap.CreatedAt)
+	return swap, err
+}
+
+// AcceptSwap applies a swap as overrides: the target takes the requester's
+// time and, for a two-way swap, the requester takes the target's time
+func (s *OverrideService) AcceptSwap(id, actorID string) (db.ShiftSwap, error) {
+	swap, err := s.GetSwap(id)
+	if err != nil {
+		return swap, err
+	}
+	if swap.TargetUserID != actorID {
+		return swap, ErrSwapForbidden
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return swap, err
+	}
+	defer tx.Rollback()
+
+	if err := s.respond(tx, &swap, db.SwapStatusAccepted, actorID); err != nil {
+		return swap, err
+	}
+
+	overrides := []db.ScheduleOverride{{
+		UserID:    swap.TargetUserID,
+		StartTime: swap.StartTime,
+		EndTime:   swap.EndTime,
+	}}
+	if swap.SwapStartTime != nil {
+		overrides = append(overrides, db.ScheduleOverride{
+			UserID:    swap.RequesterID,
+			StartTime: *swap.SwapStartTime,
+			EndTime:   *swap.SwapEndTime,
+		})
+	}
+	for _, o := range overrides {
+		o.ID = uuid.New().String()
+		o.RotationID = swap.RotationID
+		o.Reason = swap.Reason
+		o.SwapID = swap.ID
+		o.CreatedBy = actorID
+		o.CreatedAt = time.Now()
+		if err := s.insertOverride(tx, o); err != nil {
+			return swap, err
+		}
+	}
+
+	return swap, tx.Commit()
+}
+
+// DeclineSwap is answered by the target, CancelSwap by the requester
+func (s *OverrideService) DeclineSwap(id, actorID string) (db.ShiftSwap, error) {
+	swap, err := s.GetSwap(id)
+	if err != nil {
+		return swap, err
+	}
+	if swap.TargetUserID != actorID {
+		return swap, ErrSwapForbidden
+	}
+	return swap, s.respond(s.PG, &swap, db.SwapStatusDeclined, actorID)
+}
+
+func (s *OverrideService) CancelSwap(id, actorID string) (db.ShiftSwap, error) {
+	swap, err := s.GetSwap(id)
+	if err != nil {
+		return swap, err
+	}
+	if swap.RequesterID != actorID {
+		return swap, ErrSwapForbidden
+	}
+	return swap, s.respond(s.PG, &swap, db.SwapStatusCancelled, actorID)
+}
+
+// Helper functions
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *OverrideService) insertOverride(ex execer, o db.ScheduleOverride) error {
+	_, err := ex.Exec(`INSERT INTO schedule_overrides (id, rotation_id, user_id, start_time, end_time, reason, swap_id, created_by, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		o.ID, o.RotationID, o.UserID, o.StartTime, o.EndTime, o.Reason, nullString(o.SwapID), o.CreatedBy, o.CreatedAt)
+	return err
+}
+
+// respond moves a pending swap to its final status
+func (s *OverrideService) respond(ex execer, swap *db.ShiftSwap, status, actorID string) error {
+	now := time.Now()
+	result, err := ex.Exec(`UPDATE shift_swaps SET status = $2, responded_by = $3, responded_at = $4 WHERE id = $1 AND status = $5`,
+		swap.ID, status, actorID, now, db.SwapStatusPending)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrSwapNotPending
+	}
+
+	swap.Status = status
+	swap.RespondedBy = actorID
+	swap.RespondedAt = &now
+	return nil
+}
+
+func (s *OverrideService) requireActiveUser(userID string) error {
+	user, err := NewUserService(s.PG, s.Redis).GetUser(userID)
+	if err != nil || !user.IsActive {
+		return errors.New("user " + userID + " is not an active user")
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSwap(row rowScanner) (db.ShiftSwap, error) {
+	var swap db.ShiftSwap
+	var swapStart, swapEnd, respondedAt sql.NullTime
+	err := row.Scan(&swap.ID, &swap.RotationID, &swap.RequesterID, &swap.TargetUserID, &swap.StartTime, &swap.EndTime,
+		&swapStart, &swapEnd, &swap.Reason, &swap.Status, &swap.RespondedBy, &respondedAt, &swap.CreatedAt)
+	swap.StartTime, swap.EndTime = swap.StartTime.UTC(), swap.EndTime.UTC()
+	if swapStart.Valid {
+		t := swapStart.Time.UTC()
+		swap.SwapStartTime = &t
+	}
+	if swapEnd.Valid {
+		t := swapEnd.Time.UTC()
+		swap.SwapEndTime = &t
+	}
+	if respondedAt.Valid {
+		swap.RespondedAt = &respondedAt.Time
+	}
+	return swap, err
+}
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// maxShiftRange bounds how far ahead shifts are expanded in one request
+const maxShiftRange = 92 * 24 * time.Hour
+
+type RotationService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewRotationService(pg *sql.DB, redis *redis.Client) *RotationService {
+	return &RotationService{PG: pg, Redis: redis}
+}
+
+// Rotation CRUD operations
+func (s *RotationService) ListRotations() ([]db.Rotation, error) {
+	return s.queryRotations(`
+		SELECT id, name, COALESCE(description, ''), time_zone, COALESCE(team_id, ''), is_active, created_at, updated_at
+		FROM rotations
+		WHERE is_active = true
+		ORDER BY created_at
+	`)
+}
+
+// ListTeamRotations returns the active rotations owned by a team
+func (s *RotationService) ListTeamRotations(teamID string) ([]db.Rotation, error) {
+	return s.queryRotations(`
+		SELECT id, name, COALESCE(description, ''), time_zone, COALESCE(team_id, ''), is_active, created_at, updated_at
+		FROM rotations
+		WHERE is_active = true AND team_id = $1
+		ORDER BY created_at
+	`, teamID)
+}
+
+// listDefaultRotations returns the active rotations of no team, the ones the
+// default on-call comes from
+func (s *RotationService) listDefaultRotations() ([]db.Rotation, error) {
+	return s.queryRotations(`
+		SELECT id, name, COALESCE(description, ''), time_zone, COALESCE(team_id, ''), is_active, created_at, updated_at
+		FROM rotations
+		WHERE is_active = true AND team_id IS NULL
+		ORDER BY created_at
+	`)
+}
+
+func (s *RotationService) GetRotation(id string) (db.Rotation, error) {
+	var r db.Rotation
+	err := s.PG.QueryRow(`
+		SELECT id, name, COALESCE(description, ''), time_zone, COALESCE(team_id, ''), is_active, created_at, updated_at
+		FROM rotations
+		WHERE id = $1
+	`, id).Scan(&r.ID, &r.Name, &r.Description, &r.TimeZone, &r.TeamID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return r, err
+	}
+
+	r.Layers, err = s.listLayers(r.ID)
+	return r, err
+}
+
+func (s *RotationService) CreateRotation(c *gin.Context) (db.Rotation, error) {
+	var req db.RotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.Rotation{}, err
+	}
+	if err := s.validateRotation(&req); err != nil {
+		return db.Rotation{}, err
+	}
+
+	rotation := db.Rotation{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		TimeZone:    req.TimeZone,
+		TeamID:      req.TeamID,
+		IsActive:    true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return rotation, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO rotations (id, name, description, time_zone, team_id, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		rotation.ID, rotation.Name, rotation.Description, rotation.TimeZone, nullString(rotation.TeamID), rotation.IsActive, rotation.CreatedAt, rotation.UpdatedAt)
+	if err != nil {
+		return rotation, err
+	}
+
+	rotation.Layers, err = s.insertLayers(tx, rotation.ID, req.Layers)
+	if err != nil {
+		return rotation, err
+	}
+
+	return rotation, tx.Commit()
+}
+
+// UpdateRotation replaces the rotation definition, including all of its layers
+func (s *RotationService) UpdateRotation(id string, c *gin.Context) (db.Rotation, error) {
+	var req db.RotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.Rotation{}, err
+	}
+	if err := s.validateRotation(&req); err != nil {
+		return db.Rotation{}, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.Rotation{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE rotations SET name=$2, description=$3, time_zone=$4, team_id=$5, updated_at=$6 WHERE id=$1`,
+		id, req.Name, req.Description, req.TimeZone, nullString(req.TeamID), time.Now())
+	if err != nil {
+		return db.Rotation{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return db.Rotation{}, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`DELETE FROM rotation_layers WHERE rotation_id = $1`, id); err != nil {
+		return db.Rotation{}, err
+	}
+	if _, err := s.insertLayers(tx, id, req.Layers); err != nil {
+		return db.Rotation{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.Rotation{}, err
+	}
+	return s.GetRotation(id)
+}
+
+func (s *RotationService) DeleteRotation(id string) error {
+	_, err := s.PG.Exec(`UPDATE rotations SET is_active = false, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// On-call computation
+
+// OnCallAt returns the user on call for a rotation at the given time,
+// overrides included. An empty user ID means nobody covers that time.
+func (s *RotationService) OnCallAt(rotationID string, at time.Time) (string, error) {
+	rotation, err := s.GetRotation(rotationID)
+	if err != nil {
+		return "", err
+	}
+	if !rotation.IsActive {
+		return "", nil
+	}
+	return s.onCallAt(rotation, at)
+}
+
+// DefaultOnCallAt checks every active rotation without a team, oldest
+// first, and returns the first user on call
+func (s *RotationService) DefaultOnCallAt(at time.Time) (string, error) {
+	rotations, err := s.listDefaultRotations()
+	if err != nil {
+		return "", err
+	}
+
+	return s.firstOnCallAt(rotations, at), nil
+}
+
+// TeamOnCallAt is DefaultOnCallAt limited to the rotations of one team
+func (s *RotationService) TeamOnCallAt(teamID string, at time.Time) (string, error) {
+	rotations, err := s.ListTeamRotations(teamID)
+	if err != nil {
+		return "", err
+	}
+	return s.firstOnCallAt(rotations, at), nil
+}
+
+// Shifts expands a rotation into the final schedule between from and to,
+// with higher layers already applied on top of lower ones
+func (s *RotationService) Shifts(rotationID string, from, to time.Time) ([]db.Shift, error) {
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxShiftRange {
+		return nil, fmt.Errorf("time range is limited to %d days", int(maxShiftRange.Hours()/24))
+	}
+
+	rotation, err := s.GetRotation(rotationID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(rotation.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := NewOverrideService(s.PG, s.Redis).ListOverrides(rotationID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every handoff of every layer and every override edge is a point where
+	// the result can change
+	points := []time.Time{from, to}
+	for _, o := range overrides {
+		for _, t := range []time.Time{o.StartTime, o.EndTime} {
+			if t.After(from) && t.Before(to) {
+				points = append(points, t)
+			}
+		}
+	}
+	for _, layer := range rotation.Layers {
+		first, err := layerAnchor(layer, loc)
+		if err != nil {
+			return nil, err
+		}
+		k := 0
+		if from.After(first) {
+			k = layerShiftIndex(layer, first, from)
+		}
+		for start := layerBoundary(layer, first, k); start.Before(to); start = layerBoundary(layer, first, k) {
+			if start.After(from) {
+				points = append(points, start)
+			}
+			k++
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	shifts := []db.Shift{}
+	for i := 0; i < len(points)-1; i++ {
+		start, end := points[i], points[i+1]
+		if !end.After(start) {
+			continue
+		}
+		shift := db.Shift{Start: start.UTC(), End: end.UTC()}
+		if o, ok := overrideAt(overrides, start); ok {
+			shift.UserID, shift.OverrideID = o.UserID, o.ID
+		} else {
+			shift.UserID, shift.Layer = rotationOnCallAt(rotation, loc, start)
+		}
+		if shift.UserID == "" {
+			continue
+		}
+
+		if n := len(shifts); n > 0 && shifts[n-1].UserID == shift.UserID && shifts[n-1].Layer == shift.Layer &&
+			shifts[n-1].OverrideID == shift.OverrideID && shifts[n-1].End.Equal(start) {
+			shifts[n-1].End = shift.End
+			continue
+		}
+		shifts = append(shifts, shift)
+	}
+	return shifts, nil
+}
+
+// Helper functions
+
+func (s *RotationService) queryRotations(query string, args ...interface{}) ([]db.Rotation, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rotations := []db.Rotation{}
+	for rows.Next() {
+		var r db.Rotation
+		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.TimeZone, &r.TeamID, &r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			continue
+		}
+		rotations = append(rotations, r)
+	}
+
+	for i := range rotations {
+		layers, err := s.listLayers(rotations[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		rotations[i].Layers = layers
+	}
+	return rotations, nil
+}
+
+func (s *RotationService) firstOnCallAt(rotations []db.Rotation, at time.Time) string {
+	for _, rotation := range rotations {
+		userID, err := s.onCallAt(rotation, at)
+		if err != nil {
+			continue
+		}
+		if userID != "" {
+			return userID
+		}
+	}
+	return ""
+}
+
+// onCallAt applies overrides on top of the rotation layers
+func (s *RotationService) onCallAt(rotation db.Rotation, at time.Time) (string, error) {
+	overrides, err := NewOverrideService(s.PG, s.Redis).ListOverrides(rotation.ID, at, at.Add(time.Nanosecond))
+	if err != nil {
+		return "", err
+	}
+	if o, ok := overrideAt(overrides, at); ok {
+		return o.UserID, nil
+	}
+
+	loc, err := time.LoadLocation(rotation.TimeZone)
+	if err != nil {
+		return "", err
+	}
+	userID, _ := rotationOnCallAt(rotation, loc, at)
+	return userID, nil
+}
+
+// overrideAt returns the override covering t. The most recent one wins when
+// overrides overlap.
+func overrideAt(overrides []db.ScheduleOverride, t time.Time) (db.ScheduleOverride, bool) {
+	var found db.ScheduleOverride
+	ok := false
+	for _, o := range overrides {
+		if o.StartTime.After(t) || !o.EndTime.After(t) {
+			continue
+		}
+		if !ok || o.CreatedAt.After(found.CreatedAt) {
+			found, ok = o, true
+		}
+	}
+	return found, ok
+}
+
+func (s *RotationService) validateRotation(req *db.RotationRequest) error {
+	if req.TimeZone == "" {
+		req.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.TimeZone); err != nil {
+		return fmt.Errorf("invalid time_zone %q", req.TimeZone)
+	}
+	if req.TeamID != "" {
+		if _, err := NewTeamService(s.PG, s.Redis).GetTeam(req.TeamID); err != nil {
+			return err
+		}
+	}
+
+	for i := range req.Layers {
+		layer := &req.Layers[i]
+		if layer.HandoffTime == "" {
+			layer.HandoffTime = "09:00"
+		}
+		if _, err := time.Parse("15:04", layer.HandoffTime); err != nil {
+			return fmt.Errorf("layer %d: handoff_time must be HH:MM", i+1)
+		}
+		if _, err := time.Parse("2006-01-02", layer.StartDate); err != nil {
+			return fmt.Errorf("layer %d: start_date must be YYYY-MM-DD", i+1)
+		}
+		if layer.ShiftType == db.ShiftTypeCustom && layer.ShiftLengthHours < 1 {
+			return fmt.Errorf("layer %d: shift_length_hours is required for custom shifts", i+1)
+		}
+
+		var count int
+		err := s.PG.QueryRow(`SELECT COUNT(DISTINCT id) FROM users WHERE id = ANY($1) AND is_active = true`, pq.Array(layer.Participants)).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count != len(uniqueStrings(layer.Participants)) {
+			return fmt.Errorf("layer %d: participants must be active users", i+1)
+		}
+	}
+	return nil
+}
+
+func (s *RotationService) listLayers(rotationID string) ([]db.RotationLayer, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, rotation_id, layer_number, name, participants, shift_type, shift_length_hours, handoff_time, to_char(start_date, 'YYYY-MM-DD')
+		FROM rotation_layers
+		WHERE rotation_id = $1
+		ORDER BY layer_number
+	`, rotationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	layers := []db.RotationLayer{}
+	for rows.Next() {
+		var l db.RotationLayer
+		var participants pq.StringArray
+		err := rows.Scan(&l.ID, &l.RotationID, &l.LayerNumber, &l.Name, &participants, &l.ShiftType, &l.ShiftLengthHours, &l.HandoffTime, &l.StartDate)
+		if err != nil {
+			continue
+		}
+		l.Participants = []string(participants)
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+func (s *RotationService) insertLayers(tx *sql.Tx, rotationID string, reqs []db.RotationLayerRequest) ([]db.RotationLayer, error) {
+	layers := make([]db.RotationLayer, 0, len(reqs))
+	for i, req := range reqs {
+		layer := db.RotationLayer{
+			ID:               uuid.New().String(),
+			RotationID:       rotationID,
+			LayerNumber:      i + 1,
+			Name:             req.Name,
+			Participants:     req.Participants,
+			ShiftType:        req.ShiftType,
+			ShiftLengthHours: req.ShiftLengthHours,
+			HandoffTime:      req.HandoffTime,
+			StartDate:        req.StartDate,
+		}
+		if layer.Name == "" {
+			layer.Name = fmt.Sprintf("Layer %d", layer.LayerNumber)
+		}
+
+		_, err := tx.Exec(`INSERT INTO rotation_layers (id, rotation_id, layer_number, name, participants, shift_type, shift_length_hours, handoff_time, start_date) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+			layer.ID, layer.RotationID, layer.LayerNumber, layer.Name, pq.Array(layer.Participants), layer.ShiftType, layer.ShiftLengthHours, layer.HandoffTime, layer.StartDate)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// rotationOnCallAt returns the user and layer number on call at t, checking
+// the highest layer first
+func rotationOnCallAt(rotation db.Rotation, loc *time.Location, t time.Time) (string, int) {
+	for i := len(rotation.Layers) - 1; i >= 0; i-- {
+		layer := rotation.Layers[i]
+		if len(layer.Participants) == 0 {
+			continue
+		}
+		first, err := layerAnchor(layer, loc)
+		if err != nil || t.Before(first) {
+			continue
+		}
+		k := layerShiftIndex(layer, first, t)
+		return layer.Participants[k%len(layer.Participants)], layer.LayerNumber
+	}
+	return "", 0
+}
+
+// layerAnchor is the first handoff of a layer
+func layerAnchor(layer db.RotationLayer, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", layer.StartDate+" "+layer.HandoffTime, loc)
+}
+
+// layerBoundary returns the start of shift k. Shifts step in local wall-clock
+// hours, so handoffs stay at the same local time across DST changes; the
+// shift spanning the change is an hour shorter or longer instead.
+func layerBoundary(layer db.RotationLayer, first time.Time, k int) time.Time {
+	return time.Date(first.Year(), first.Month(), first.Day(), first.Hour()+k*layerShiftHours(layer), first.Minute(), 0, 0, first.Location())
+}
+
+// layerShiftIndex returns the shift k with boundary(k) <= t < boundary(k+1)
+func layerShiftIndex(layer db.RotationLayer, first, t time.Time) int {
+	// Estimate with a fixed length, then correct for DST shifted shifts
+	k := int(t.Sub(first) / (time.Duration(layerShiftHours(layer)) * time.Hour))
+	for k > 0 && layerBoundary(layer, first, k).After(t) {
+		k--
+	}
+	for !layerBoundary(layer, first, k+1).After(t) {
+		k++
+	}
+	return k
+}
+
+func layerShiftHours(layer db.RotationLayer) int {
+	switch layer.ShiftType {
+	case db.ShiftTypeDaily:
+		return 24
+	case db.ShiftTypeWeekly:
+		return 7 * 24
+	default:
+		return layer.ShiftLengthHours
+	}
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys used by the job scheduler
+const (
+	jobScheduleKey   = "jobs:schedule"   // ZSET job ID -> due time (unix ms)
+	jobProcessingKey = "jobs:processing" // ZSET job ID -> lease deadline (unix ms)
+	jobDataKey       = "jobs:data"       // HASH job ID -> job JSON
+)
+
+// Job types
+const (
+	JobTypeEscalation        = "escalation"
+	JobTypeNotificationRule  = "notification_rule"
+	JobTypeNotificationRetry = "notification_retry"
+	JobTypeSnoozeExpiry      = "snooze_expiry"
+	JobTypePage              = "page" // Page a user, or the targets of a level when UserID is empty
+)
+
+// jobLease is how long a worker may hold a claimed job before it is handed
+// to another worker. Workers renew it before running each job of a batch.
+const jobLease = 2 * time.Minute
+
+// ScheduledJob is a unit of delayed work stored in Redis
+type ScheduledJob struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	AlertID string    `json:"alert_id"`
+	Level   int       `json:"level,omitempty"` // Escalation level 0 starts paging at the first level
+	Attempt int       `json:"attempt,omitempty"`
+	UserID  string    `json:"user_id,omitempty"`
+	RuleID  string    `json:"rule_id,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	DueAt   time.Time `json:"due_at"`
+
+	lease string // Lease deadline the job was claimed or renewed with
+}
+
+// Claim moves due jobs to the processing set in one step so that only one
+// worker instance gets each job
+var claimDueJobsScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[3], id)
+end
+return ids
+`)
+
+// Complete drops a processed job, keeping its data if it was rescheduled
+// while being processed
+var completeJobScript = redis.NewScript(`
+redis.call('ZREM', KEYS[2], ARGV[1])
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	redis.call('HDEL', KEYS[3], ARGV[1])
+end
+return 1
+`)
+
+// Renew extends the lease of a claimed job, unless the lease ran out and the
+// job was requeued or claimed by another worker since
+var renewJobLeaseScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// Requeue moves jobs whose lease expired back to the schedule
+var requeueStaleJobsScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], 'NX', ARGV[1], id)
+end
+return #ids
+`)
+
+type JobScheduler struct {
+	Redis *redis.Client
+}
+
+func NewJobScheduler(redis *redis.Client) *JobScheduler {
+	return &JobScheduler{Redis: redis}
+}
+
+// EscalationJobID returns the ID of the single escalation job an alert can have
+func EscalationJobID(alertID string) string {
+	return JobTypeEscalation + ":" + alertID
+}
+
+// NotificationRuleJobID returns the ID of a delayed notification rule job
+func NotificationRuleJobID(alertID, ruleID string) string {
+	return JobTypeNotificationRule + ":" + alertID + ":" + ruleID
+}
+
+// NotificationRetryJobID returns the ID of the retry of a failed delivery
+func NotificationRetryJobID(notificationID string) string {
+	return JobTypeNotificationRetry + ":" + notificationID
+}
+
+// SnoozeJobID returns the ID of the job reopening a snoozed alert
+func SnoozeJobID(alertID string) string {
+	return JobTypeSnoozeExpiry + ":" + alertID
+}
+
+// PageJobID returns the ID of the job paging a user, or a level's targets
+// when userID is empty
+func PageJobID(alertID, userID string, level int) string {
+	if userID == "" {
+		return JobTypePage + ":" + alertID + ":level:" + strconv.Itoa(level)
+	}
+	return JobTypePage + ":" + alertID + ":" + userID
+}
+
+// Schedule stores a job to run at job.DueAt. Scheduling an existing job ID
+// replaces it.
+func (s *JobScheduler) Schedule(ctx context.Context, job ScheduledJob) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobDataKey, job.ID, b)
+		pipe.ZAdd(ctx, jobScheduleKey, &redis.Z{Score: float64(job.DueAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+// Cancel removes a pending job. It reports whether a job was actually pending.
+func (s *JobScheduler) Cancel(ctx context.Context, jobID string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, jobScheduleKey, jobID)
+		pipe.HDel(ctx, jobDataKey, jobID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed.Val() > 0, nil
+}
+
+// Get returns a pending job, or redis.Nil if there is none
+func (s *JobScheduler) Get(ctx context.Context, jobID string) (ScheduledJob, error) {
+	var job ScheduledJob
+	if _, err := s.Redis.ZScore(ctx, jobScheduleKey, jobID).Result(); err != nil {
+		return job, err
+	}
+	b, err := s.Redis.HGet(ctx, jobDataKey, jobID).Bytes()
+	if err != nil {
+		return job, err
+	}
+	err = json.Unmarshal(b, &job)
+	return job, err
+}
+
+// ClaimDue claims up to limit jobs that are due. Claimed jobs must be
+// passed to Complete once handled, otherwise they run again after the lease.
+func (s *JobScheduler) ClaimDue(ctx context.Context, limit int) ([]ScheduledJob, error) {
+	now := time.Now()
+	lease := strconv.FormatInt(now.Add(jobLease).UnixMilli(), 10)
+	ids, err := claimDueJobsScript.Run(ctx, s.Redis,
+		[]string{jobScheduleKey, jobProcessingKey},
+		strconv.FormatInt(now.UnixMilli(), 10), limit, lease,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	values, err := s.Redis.HMGet(ctx, jobDataKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]ScheduledJob, 0, len(ids))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// Job data vanished (cancelled), nothing left to do
+			s.Complete(ctx, ids[i])
+			continue
+		}
+		var job ScheduledJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			s.Complete(ctx, ids[i])
+			continue
+		}
+		job.lease = lease
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Renew restarts the lease of a claimed job just before it runs. It reports
+// false when the job is no longer held by this worker; it must then be
+// skipped, another worker runs it.
+func (s *JobScheduler) Renew(ctx context.Context, job *ScheduledJob) (bool, error) {
+	lease := strconv.FormatInt(time.Now().Add(jobLease).UnixMilli(), 10)
+	held, err := renewJobLeaseScript.Run(ctx, s.Redis, []string{jobProcessingKey}, job.ID, job.lease, lease).Int()
+	if err != nil || held == 0 {
+		return false, err
+	}
+	job.lease = lease
+	return true, nil
+}
+
+// Complete marks a claimed job as handled
+func (s *JobScheduler) Complete(ctx context.Context, jobID string) error {
+	return completeJobScript.Run(ctx, s.Redis, []string{jobScheduleKey, jobProcessingKey, jobDataKey}, jobID).Err()
+}
+
+// RequeueStale puts jobs claimed by a worker that died back on the schedule
+func (s *JobScheduler) RequeueStale(ctx context.Context) (int, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return requeueStaleJobsScript.Run(ctx, s.Redis, []string{jobScheduleKey, jobProcessingKey}, now).Int()
+}
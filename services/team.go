@@ -0,0 +1,262 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// Routing rules without an explicit priority
+const defaultRoutingPriority = 100
+
+var (
+	ErrTeamNotFound        = errors.New("team not found")
+	ErrRoutingRuleNotFound = errors.New("routing rule not found")
+)
+
+type TeamService struct {
+	PG    *sql.DB
+	Redis *redis.Client
+}
+
+func NewTeamService(pg *sql.DB, redis *redis.Client) *TeamService {
+	return &TeamService{PG: pg, Redis: redis}
+}
+
+// Team CRUD operations
+func (s *TeamService) ListTeams() ([]db.Team, error) {
+	rows, err := s.PG.Query(`
+		SELECT id, name, COALESCE(description, ''), COALESCE(escalation_policy_id, ''), is_active, created_at, updated_at
+		FROM teams
+		WHERE is_active = true
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []db.Team{}
+	for rows.Next() {
+		var t db.Team
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.EscalationPolicyID, &t.IsActive, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			continue
+		}
+		teams = append(teams, t)
+	}
+	return teams, nil
+}
+
+// GetTeam returns a team with its members
+func (s *TeamService) GetTeam(id string) (db.Team, error) {
+	var t db.Team
+	err := s.PG.QueryRow(`
+		SELECT id, name, COALESCE(description, ''), COALESCE(escalation_policy_id, ''), is_active, created_at, updated_at
+		FROM teams
+		WHERE id = $1
+	`, id).Scan(&t.ID, &t.Name, &t.Description, &t.EscalationPolicyID, &t.IsActive, &t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return t, ErrTeamNotFound
+	} else if err != nil {
+		return t, err
+	}
+
+	t.Members, err = NewEscalationService(s.PG, s.Redis).listTeamUsers(t.Name)
+	return t, err
+}
+
+func (s *TeamService) CreateTeam(c *gin.Context) (db.Team, error) {
+	var req db.TeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.Team{}, err
+	}
+	if err := s.validateTeam(req); err != nil {
+		return db.Team{}, err
+	}
+
+	team := db.Team{
+		ID:                 uuid.New().String(),
+		Name:               req.Name,
+		Description:        req.Description,
+		EscalationPolicyID: req.EscalationPolicyID,
+		IsActive:           true,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO teams (id, name, description, escalation_policy_id, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		team.ID, team.Name, team.Description, nullString(team.EscalationPolicyID), team.IsActive, team.CreatedAt, team.UpdatedAt)
+	return team, err
+}
+
+// UpdateTeam changes a team. Renaming a team moves its members along.
+func (s *TeamService) UpdateTeam(id string, c *gin.Context) (db.Team, error) {
+	var req db.TeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.Team{}, err
+	}
+	if err := s.validateTeam(req); err != nil {
+		return db.Team{}, err
+	}
+
+	current, err := s.GetTeam(id)
+	if err != nil {
+		return db.Team{}, err
+	}
+
+	tx, err := s.PG.Begin()
+	if err != nil {
+		return db.Team{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE teams SET name=$2, description=$3, escalation_policy_id=$4, updated_at=$5 WHERE id=$1`,
+		id, req.Name, req.Description, nullString(req.EscalationPolicyID), now)
+	if err != nil {
+		return db.Team{}, err
+	}
+	if req.Name != current.Name {
+		if _, err := tx.Exec(`UPDATE users SET team = $1, updated_at = $2 WHERE team = $3`, req.Name, now, current.Name); err != nil {
+			return db.Team{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.Team{}, err
+	}
+	return s.GetTeam(id)
+}
+
+// DeleteTeam deactivates a team. Its alerts, rotations and schedules keep
+// the reference, new alerts are no longer routed to it.
+func (s *TeamService) DeleteTeam(id string) error {
+	_, err := s.PG.Exec(`UPDATE teams SET is_active = false, updated_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+// Routing rule operations
+func (s *TeamService) ListRoutingRules(teamID string) ([]db.RoutingRule, error) {
+	return s.queryRoutingRules(`
+		SELECT id, team_id, match_type, match_key, match_value, priority, created_at
+		FROM team_routing_rules
+		WHERE team_id = $1
+		ORDER BY priority, created_at
+	`, teamID)
+}
+
+func (s *TeamService) CreateRoutingRule(teamID string, c *gin.Context) (db.RoutingRule, error) {
+	var req db.RoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return db.RoutingRule{}, err
+	}
+	if req.MatchType == db.RouteMatchLabel && req.MatchKey == "" {
+		return db.RoutingRule{}, errors.New("match_key is required for label rules")
+	}
+	if req.MatchType != db.RouteMatchLabel {
+		req.MatchKey = ""
+	}
+	if _, err := s.GetTeam(teamID); err != nil {
+		return db.RoutingRule{}, err
+	}
+
+	rule := db.RoutingRule{
+		ID:         uuid.New().String(),
+		TeamID:     teamID,
+		MatchType:  req.MatchType,
+		MatchKey:   req.MatchKey,
+		MatchValue: req.MatchValue,
+		Priority:   defaultRoutingPriority,
+		CreatedAt:  time.Now(),
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+
+	_, err := s.PG.Exec(`INSERT INTO team_routing_rules (id, team_id, match_type, match_key, match_value, priority, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		rule.ID, rule.TeamID, rule.MatchType, rule.MatchKey, rule.MatchValue, rule.Priority, rule.CreatedAt)
+	return rule, err
+}
+
+func (s *TeamService) DeleteRoutingRule(teamID, ruleID string) error {
+	result, err := s.PG.Exec(`DELETE FROM team_routing_rules WHERE id = $1 AND team_id = $2`, ruleID, teamID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrRoutingRuleNotFound
+	}
+	return nil
+}
+
+// RouteAlert returns the team of the first rule matching the alert, lowest
+// priority first. An empty ID means no rule matched.
+func (s *TeamService) RouteAlert(source string, labels map[string]string, apiKeyID string) (string, error) {
+	rules, err := s.queryRoutingRules(`
+		SELECT r.id, r.team_id, r.match_type, r.match_key, r.match_value, r.priority, r.created_at
+		FROM team_routing_rules r
+		JOIN teams t ON t.id = r.team_id
+		WHERE t.is_active = true
+		ORDER BY r.priority, r.created_at
+	`)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rule := range rules {
+		if routingRuleMatches(rule, source, labels, apiKeyID) {
+			return rule.TeamID, nil
+		}
+	}
+	return "", nil
+}
+
+// Helper functions
+
+func (s *TeamService) validateTeam(req db.TeamRequest) error {
+	if req.EscalationPolicyID == "" {
+		return nil
+	}
+	policy, err := NewEscalationService(s.PG, s.Redis).GetPolicy(req.EscalationPolicyID)
+	if err != nil || !policy.IsActive {
+		return errors.New("escalation policy " + req.EscalationPolicyID + " not found")
+	}
+	return nil
+}
+
+func (s *TeamService) queryRoutingRules(query string, args ...interface{}) ([]db.RoutingRule, error) {
+	rows, err := s.PG.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []db.RoutingRule{}
+	for rows.Next() {
+		var r db.RoutingRule
+		if err := rows.Scan(&r.ID, &r.TeamID, &r.MatchType, &r.MatchKey, &r.MatchValue, &r.Priority, &r.CreatedAt); err != nil {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func routingRuleMatches(rule db.RoutingRule, source string, labels map[string]string, apiKeyID string) bool {
+	switch rule.MatchType {
+	case db.RouteMatchSource:
+		return rule.MatchValue == source
+	case db.RouteMatchLabel:
+		value, ok := labels[rule.MatchKey]
+		return ok && value == rule.MatchValue
+	case db.RouteMatchAPIKey:
+		return apiKeyID != "" && rule.MatchValue == apiKeyID
+	default:
+		return false
+	}
+}
@@ -1,11 +1,11 @@
 package services
 
 import (
-	"context"
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -30,7 +30,8 @@ func (s *UptimeService) ListServices() ([]db.Service, error) {
 	rows, err := s.PG.Query(`
 		SELECT id, name, url, type, method, interval_seconds, timeout_seconds, 
 		       is_active, is_enabled, created_at, updated_at, expected_status, 
-		       COALESCE(expected_body, ''), COALESCE(headers::text, '{}')
+		       COALESCE(expected_body, ''), COALESCE(headers::text, '{}'),
+		       COALESCE(escalation_policy_id, '')
 		FROM services 
 		ORDER BY created_at DESC
 	`)
@@ -47,7 +48,7 @@ func (s *UptimeService) ListServices() ([]db.Service, error) {
 			&service.ID, &service.Name, &service.URL, &service.Type, &service.Method,
 			&service.Interval, &service.Timeout, &service.IsActive, &service.IsEnabled,
 			&service.CreatedAt, &service.UpdatedAt, &service.ExpectedStatus,
-			&service.ExpectedBody, &headersJSON,
+			&service.ExpectedBody, &headersJSON, &service.EscalationPolicyID,
 		)
 		if err != nil {
 			continue
@@ -70,13 +71,14 @@ func (s *UptimeService) GetService(id string) (db.Service, error) {
 	err := s.PG.QueryRow(`
 		SELECT id, name, url, type, method, interval_seconds, timeout_seconds, 
 		       is_active, is_enabled, created_at, updated_at, expected_status, 
-		       COALESCE(expected_body, ''), COALESCE(headers::text, '{}')
+		       COALESCE(expected_body, ''), COALESCE(headers::text, '{}'),
+		       COALESCE(escalation_policy_id, '')
 		FROM services WHERE id = $1
 	`, id).Scan(
 		&service.ID, &service.Name, &service.URL, &service.Type, &service.Method,
 		&service.Interval, &service.Timeout, &service.IsActive, &service.IsEnabled,
 		&service.CreatedAt, &service.UpdatedAt, &service.ExpectedStatus,
-		&service.ExpectedBody, &headersJSON,
+		&service.ExpectedBody, &headersJSON, &service.EscalationPolicyID,
 	)
 
 	if err != nil {
@@ -131,12 +133,12 @@ func (s *UptimeService) CreateService(c *gin.Context) (db.Service, error) {
 	_, err := s.PG.Exec(`
 		INSERT INTO services (id, name, url, type, method, interval_seconds, timeout_seconds, 
 		                     is_active, is_enabled, created_at, updated_at, expected_status, 
-		                     expected_body, headers)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		                     expected_body, headers, escalation_policy_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`, service.ID, service.Name, service.URL, service.Type, service.Method,
 		service.Interval, service.Timeout, service.IsActive, service.IsEnabled,
 		service.CreatedAt, service.UpdatedAt, service.ExpectedStatus,
-		service.ExpectedBody, headersJSON)
+		service.ExpectedBody, headersJSON, nullString(service.EscalationPolicyID))
 
 	if err != nil {
 		return service, err
@@ -392,11 +394,23 @@ func (s *UptimeService) updateServiceStats(serviceID string) {
 }
 
 func (s *UptimeService) checkForIncidents(service db.Service, check db.ServiceCheck) {
+	// A service coming back up still ends its downtime
+	if check.Status == "up" {
+		s.resolveDowntimeIncident(service.ID)
+	}
+
+	// No incident is opened during planned maintenance
+	window, inMaintenance, err := NewMaintenanceService(s.PG, s.Redis).ActiveWindow(UptimeAlertSource, AlertRoute{ServiceID: service.ID}, check.CheckedAt)
+	if err != nil {
+		log.Printf("Failed to look up maintenance windows for service %s: %v", service.ID, err)
+	} else if inMaintenance {
+		log.Printf("Service %s is in maintenance window %s, no incident opened", service.ID, window.ID)
+		return
+	}
+
 	// Check for downtime incident
 	if check.Status != "up" {
 		s.handleDowntimeIncident(service.ID, check)
-	} else {
-		s.resolveDowntimeIncident(service.ID)
 	}
 
 	// Check for slow response incident (if response time > 5 seconds)
@@ -445,9 +459,26 @@ func (s *UptimeService) resolveDowntimeIncident(serviceID string) {
 		    duration_seconds = EXTRACT(EPOCH FROM (NOW() - started_at))::INTEGER
 		WHERE service_id = $1 AND type = 'downtime' AND status = 'ongoing'
 	`, serviceID)
+	if err != nil {
+		log.Printf("Failed to resolve downtime incident of service %s: %v", serviceID, err)
+	}
+	s.ResolveDowntimeAlert(serviceID)
+}
 
-	if err == nil {
-		// TODO: Send resolution notification
+// ResolveDowntimeAlert resolves the open downtime alert of a service that is
+// back up, so that its next outage opens and pages a new alert instead of
+// counting on this one
+func (s *UptimeService) ResolveDowntimeAlert(serviceID string) {
+	var alertID string
+	err := s.PG.QueryRow(`SELECT id FROM alerts WHERE dedup_key = $1 AND status NOT IN ('resolved', 'closed')`, UptimeDedupKey(serviceID)).Scan(&alertID)
+	if err == sql.ErrNoRows {
+		return
+	} else if err != nil {
+		log.Printf("Failed to look up downtime alert of service %s: %v", serviceID, err)
+		return
+	}
+	if _, err := NewAlertService(s.PG, s.Redis).ResolveAlert(alertID, ""); err != nil {
+		log.Printf("Failed to resolve downtime alert %s of service %s: %v", alertID, serviceID, err)
 	}
 }
 
@@ -469,40 +500,32 @@ func (s *UptimeService) createDowntimeAlert(serviceID, incidentID, description s
 	}
 
 	alert := db.Alert{
-		ID:          uuid.New().String(),
 		Title:       fmt.Sprintf("[UPTIME] Service Down: %s", service.Name),
 		Description: description,
-		Status:      "new",
+		Status:      db.AlertStatusNew,
 		Severity:    "high",
-		Source:      "uptime_monitor",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Source:      UptimeAlertSource,
+		DedupKey:    UptimeDedupKey(serviceID),
 	}
 
-	// Auto-assign to current on-call user
-	userService := NewUserService(s.PG, s.Redis)
-	onCallUser, err := userService.GetCurrentOnCallUser()
-	if err == nil {
-		alert.AssignedTo = onCallUser.ID
-		now := time.Now()
-		alert.AssignedAt = &now
+	// Route to a team and assign its on-call; the service's policy wins
+	// over the team and source policies. A flapping service keeps counting
+	// on the alert that is still open.
+	created, err := NewAlertService(s.PG, s.Redis).CreateRoutedAlert(&alert, AlertRoute{ServiceID: serviceID})
+	if err != nil {
+		return
 	}
 
-	// Save alert
-	_, err = s.PG.Exec(`
-		INSERT INTO alerts (id, title, description, status, created_at, updated_at, severity, source, assigned_to, assigned_at) 
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-	`, alert.ID, alert.Title, alert.Description, alert.Status, alert.CreatedAt, alert.UpdatedAt,
-		alert.Severity, alert.Source, alert.AssignedTo, alert.AssignedAt)
+	// Update incident with alert ID
+	s.PG.Exec(`UPDATE service_incidents SET alert_id = $1 WHERE id = $2`, created.ID, incidentID)
+}
 
-	if err == nil {
-		// Add to worker queue
-		b, _ := json.Marshal(alert)
-		s.Redis.RPush(context.Background(), "alerts:queue", b)
+// UptimeAlertSource is the source of every alert raised by uptime checks
+const UptimeAlertSource = "uptime_monitor"
 
-		// Update incident with alert ID
-		s.PG.Exec(`UPDATE service_incidents SET alert_id = $1 WHERE id = $2`, alert.ID, incidentID)
-	}
+// UptimeDedupKey is shared by every alert raised for a service being down
+func UptimeDedupKey(serviceID string) string {
+	return "uptime:" + serviceID
 }
 
 func (s *UptimeService) initializeStatsForService(serviceID string) {
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vanchonlee/oncallkit/db"
+)
+
+// uptimeTestService connects to the migrated database and Redis named by
+// TEST_DATABASE_URL and TEST_REDIS_ADDR (./mg.sh up), skipping without them
+func uptimeTestService(t *testing.T) *UptimeService {
+	t.Helper()
+	dsn, addr := os.Getenv("TEST_DATABASE_URL"), os.Getenv("TEST_REDIS_ADDR")
+	if dsn == "" || addr == "" {
+		t.Skip("TEST_DATABASE_URL and TEST_REDIS_ADDR are not set")
+	}
+
+	pg, redis := db.NewPostgres(dsn), db.NewRedis(addr)
+	if err := pg.Ping(); err != nil {
+		t.Fatalf("postgres: %v", err)
+	}
+	if err := redis.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("redis: %v", err)
+	}
+	t.Cleanup(func() {
+		pg.Close()
+		redis.Close()
+	})
+	return NewUptimeService(pg, redis)
+}
+
+// openDowntimeAlerts returns the IDs of the service's downtime alerts that
+// are not resolved or closed
+func openDowntimeAlerts(t *testing.T, s *UptimeService, serviceID string) []string {
+	t.Helper()
+	rows, err := s.PG.Query(`SELECT id FROM alerts WHERE dedup_key = $1 AND status NOT IN ('resolved', 'closed')`, UptimeDedupKey(serviceID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestCheckServiceDownUpDownOpensNewAlert(t *testing.T) {
+	s := uptimeTestService(t)
+
+	var up atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+
+	serviceID := uuid.New().String()
+	_, err := s.PG.Exec(`INSERT INTO services (id, name, url, type, method, timeout_seconds, expected_status) VALUES ($1, $2, $3, 'http', 'GET', 5, 200)`,
+		serviceID, "uptime test "+serviceID, target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.PG.Exec(`DELETE FROM alerts WHERE dedup_key = $1`, UptimeDedupKey(serviceID))
+		s.PG.Exec(`DELETE FROM services WHERE id = $1`, serviceID)
+	})
+
+	// Down: an alert is opened
+	if _, err := s.CheckService(serviceID); err != nil {
+		t.Fatalf("first check: %v", err)
+	}
+	first := openDowntimeAlerts(t, s, serviceID)
+	if len(first) != 1 {
+		t.Fatalf("after going down: %d open alerts, want 1", len(first))
+	}
+
+	// Up: the incident and its alert are resolved
+	up.Store(true)
+	if _, err := s.CheckService(serviceID); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+	if open := openDowntimeAlerts(t, s, serviceID); len(open) != 0 {
+		t.Fatalf("after recovery: alerts %v still open", open)
+	}
+	var status string
+	if err := s.PG.QueryRow(`SELECT status FROM alerts WHERE id = $1`, first[0]).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != db.AlertStatusResolved {
+		t.Fatalf("first alert is %s, want resolved", status)
+	}
+
+	// Down again: a new alert pages instead of counting on the old one
+	up.Store(false)
+	if _, err := s.CheckService(serviceID); err != nil {
+		t.Fatalf("third check: %v", err)
+	}
+	second := openDowntimeAlerts(t, s, serviceID)
+	if len(second) != 1 || second[0] == first[0] {
+		t.Fatalf("after going down again: open alerts %v, want one new alert", second)
+	}
+	var count int
+	if err := s.PG.QueryRow(`SELECT count FROM alerts WHERE id = $1`, second[0]).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("new alert count = %d, want 1", count)
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +12,9 @@ import (
 	"github.com/vanchonlee/oncallkit/db"
 )
 
+// ErrScheduleOverlap means a new schedule row covers time another row already covers
+var ErrScheduleOverlap = errors.New("schedule overlaps an existing on-call shift")
+
 type UserService struct {
 	PG    *sql.DB
 	Redis *redis.Client
@@ -119,15 +124,28 @@ func (s *UserService) DeleteUser(id string) error {
 }
 
 // On-call schedule operations
+
+// GetCurrentOnCallUser computes the default on-call from the rotations
+// without a team. Hand entered on_call_schedules rows without a team are only
+// used when no such rotation covers now. Team rotations and rows never page
+// for alerts outside their team.
 func (s *UserService) GetCurrentOnCallUser() (db.User, error) {
-	var u db.User
 	now := time.Now()
 
-	err := s.PG.QueryRow(`
+	userID, err := NewRotationService(s.PG, s.Redis).DefaultOnCallAt(now)
+	if err != nil {
+		return db.User{}, err
+	}
+	if userID != "" {
+		return s.GetUser(userID)
+	}
+
+	var u db.User
+	err = s.PG.QueryRow(`
 		SELECT u.id, u.name, u.email, COALESCE(u.phone, '') as phone, u.role, u.team, COALESCE(u.fcm_token, '') as fcm_token, u.is_active, u.created_at, u.updated_at 
 		FROM users u 
 		JOIN on_call_schedules ocs ON u.id = ocs.user_id 
-		WHERE ocs.start_time <= $1 AND ocs.end_time >= $1 AND ocs.is_active = true AND u.is_active = true
+		WHERE ocs.team_id IS NULL AND ocs.start_time <= $1 AND ocs.end_time >= $1 AND ocs.is_active = true AND u.is_active = true
 		ORDER BY ocs.start_time DESC 
 		LIMIT 1`, now).
 		Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.Role, &u.Team, &u.FCMToken, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
@@ -135,24 +153,118 @@ func (s *UserService) GetCurrentOnCallUser() (db.User, error) {
 	return u, err
 }
 
+// GetTeamOnCallUser is GetCurrentOnCallUser for one team: the team's
+// rotations first, then the team's schedule rows
+func (s *UserService) GetTeamOnCallUser(teamID string) (db.User, error) {
+	now := time.Now()
+
+	userID, err := NewRotationService(s.PG, s.Redis).TeamOnCallAt(teamID, now)
+	if err != nil {
+		return db.User{}, err
+	}
+	if userID != "" {
+		return s.GetUser(userID)
+	}
+
+	var u db.User
+	err = s.PG.QueryRow(`
+		SELECT u.id, u.name, u.email, COALESCE(u.phone, '') as phone, u.role, u.team, COALESCE(u.fcm_token, '') as fcm_token, u.is_active, u.created_at, u.updated_at 
+		FROM users u 
+		JOIN on_call_schedules ocs ON u.id = ocs.user_id 
+		WHERE ocs.team_id = $2 AND ocs.start_time <= $1 AND ocs.end_time >= $1 AND ocs.is_active = true AND u.is_active = true
+		ORDER BY ocs.start_time DESC 
+		LIMIT 1`, now, teamID).
+		Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.Role, &u.Team, &u.FCMToken, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+
+	return u, err
+}
+
+// GetRotationOnCallUser returns the user on call for one rotation
+func (s *UserService) GetRotationOnCallUser(rotationID string) (db.User, error) {
+	userID, err := NewRotationService(s.PG, s.Redis).OnCallAt(rotationID, time.Now())
+	if err != nil {
+		return db.User{}, err
+	}
+	if userID == "" {
+		return db.User{}, sql.ErrNoRows
+	}
+	return s.GetUser(userID)
+}
+
 func (s *UserService) CreateOnCallSchedule(c *gin.Context) (db.OnCallSchedule, error) {
 	var schedule db.OnCallSchedule
 	if err := c.ShouldBindJSON(&schedule); err != nil {
 		return schedule, err
 	}
+	return s.AddOnCallSchedule(schedule)
+}
+
+// AddOnCallSchedule validates and stores a hand-entered or imported shift
+func (s *UserService) AddOnCallSchedule(schedule db.OnCallSchedule) (db.OnCallSchedule, error) {
+	if schedule.TimeZone == "" {
+		schedule.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		return schedule, fmt.Errorf("invalid time_zone %q", schedule.TimeZone)
+	}
+	if !schedule.EndTime.After(schedule.StartTime) {
+		return schedule, errors.New("end_time must be after start_time")
+	}
+	if _, err := s.GetUser(schedule.UserID); err != nil {
+		return schedule, fmt.Errorf("user %s not found", schedule.UserID)
+	}
+	if schedule.TeamID != "" {
+		if _, err := NewTeamService(s.PG, s.Redis).GetTeam(schedule.TeamID); err != nil {
+			return schedule, err
+		}
+	}
+
+	// Only rows of the same team (or both without a team) may not overlap
+	var overlapping string
+	err := s.PG.QueryRow(`SELECT id FROM on_call_schedules WHERE is_active = true AND start_time < $2 AND end_time > $1 AND team_id IS NOT DISTINCT FROM $3 LIMIT 1`,
+		schedule.StartTime, schedule.EndTime, nullString(schedule.TeamID)).Scan(&overlapping)
+	if err == nil {
+		return schedule, fmt.Errorf("%w (%s)", ErrScheduleOverlap, overlapping)
+	} else if err != sql.ErrNoRows {
+		return schedule, err
+	}
 
 	schedule.ID = uuid.New().String()
+	schedule.StartTime = schedule.StartTime.UTC()
+	schedule.EndTime = schedule.EndTime.UTC()
 	schedule.IsActive = true
 	schedule.CreatedAt = time.Now()
 
-	_, err := s.PG.Exec(`INSERT INTO on_call_schedules (id, user_id, start_time, end_time, is_active, created_at) VALUES ($1,$2,$3,$4,$5,$6)`,
-		schedule.ID, schedule.UserID, schedule.StartTime, schedule.EndTime, schedule.IsActive, schedule.CreatedAt)
+	_, err = s.PG.Exec(`INSERT INTO on_call_schedules (id, user_id, start_time, end_time, time_zone, team_id, is_active, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		schedule.ID, schedule.UserID, schedule.StartTime, schedule.EndTime, schedule.TimeZone, nullString(schedule.TeamID), schedule.IsActive, schedule.CreatedAt)
 
 	return schedule, err
 }
 
 func (s *UserService) ListOnCallSchedules() ([]db.OnCallSchedule, error) {
-	rows, err := s.PG.Query(`SELECT id, user_id, start_time, end_time, is_active, created_at FROM on_call_schedules WHERE is_active = true ORDER BY start_time DESC`)
+	rows, err := s.PG.Query(`SELECT id, user_id, start_time, end_time, time_zone, COALESCE(team_id, ''), is_active, created_at FROM on_call_schedules WHERE is_active = true ORDER BY start_time DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []db.OnCallSchedule
+	for rows.Next() {
+		var s db.OnCallSchedule
+		err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &s.EndTime, &s.TimeZone, &s.TeamID, &s.IsActive, &s.CreatedAt)
+		if err != nil {
+			continue
+		}
+		s.StartTime, s.EndTime = s.StartTime.UTC(), s.EndTime.UTC()
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// ListUserOnCallSchedules returns a user's schedule rows overlapping the range
+func (s *UserService) ListUserOnCallSchedules(userID string, from, to time.Time) ([]db.OnCallSchedule, error) {
+	rows, err := s.PG.Query(`SELECT id, user_id, start_time, end_time, time_zone, COALESCE(team_id, ''), is_active, created_at FROM on_call_schedules WHERE user_id = $1 AND is_active = true AND start_time < $3 AND end_time > $2 ORDER BY start_time`,
+		userID, from, to)
 	if err != nil {
 		return nil, err
 	}
@@ -161,10 +273,11 @@ func (s *UserService) ListOnCallSchedules() ([]db.OnCallSchedule, error) {
 	var schedules []db.OnCallSchedule
 	for rows.Next() {
 		var s db.OnCallSchedule
-		err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &s.EndTime, &s.IsActive, &s.CreatedAt)
+		err := rows.Scan(&s.ID, &s.UserID, &s.StartTime, &s.EndTime, &s.TimeZone, &s.TeamID, &s.IsActive, &s.CreatedAt)
 		if err != nil {
 			continue
 		}
+		s.StartTime, s.EndTime = s.StartTime.UTC(), s.EndTime.UTC()
 		schedules = append(schedules, s)
 	}
 	return schedules, nil
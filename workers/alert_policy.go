@@ -0,0 +1,30 @@
+package workers
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+// StartAlertPolicyWorker resolves or closes stale alerts by their alert
+// policies once a minute. Resolve events are handled as they come in.
+func StartAlertPolicyWorker(pg *sql.DB, redis *redis.Client) {
+	log.Println("Alert policy worker started, checking for stale alerts every minute...")
+
+	policyService := services.NewAlertPolicyService(pg, redis)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		changed, err := policyService.ApplyStalePolicies()
+		if err != nil {
+			log.Printf("Alert policy worker: failed to apply stale policies: %v", err)
+		}
+		if changed > 0 {
+			log.Printf("Alert policy worker: resolved or closed %d stale alerts", changed)
+		}
+	}
+}
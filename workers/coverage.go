@@ -0,0 +1,101 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vanchonlee/oncallkit/db"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+// StartCoverageWorker looks ahead for stretches of time nobody is on call and
+// raises an alert for each one. The look-ahead is COVERAGE_GAP_HORIZON_HOURS
+// (default 24, 0 disables the check).
+func StartCoverageWorker(pg *sql.DB, redis *redis.Client) {
+	horizon := 24 * time.Hour
+	if v := os.Getenv("COVERAGE_GAP_HORIZON_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours < 0 {
+			log.Printf("Coverage worker: invalid COVERAGE_GAP_HORIZON_HOURS %q, using 24", v)
+		} else {
+			horizon = time.Duration(hours) * time.Hour
+		}
+	}
+	if horizon == 0 {
+		log.Println("Coverage worker disabled")
+		return
+	}
+	log.Printf("Coverage worker started, looking %v ahead for on-call gaps...", horizon)
+
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+
+	checkCoverage(pg, redis, horizon)
+	for {
+		select {
+		case <-ticker.C:
+			checkCoverage(pg, redis, horizon)
+		}
+	}
+}
+
+// checkCoverage checks the company wide on-call and every team separately
+func checkCoverage(pg *sql.DB, redis *redis.Client, horizon time.Duration) {
+	teams, err := services.NewTeamService(pg, redis).ListTeams()
+	if err != nil {
+		log.Printf("Coverage worker: failed to list teams: %v", err)
+	}
+
+	checkTeamCoverage(pg, redis, horizon, db.Team{})
+	for _, team := range teams {
+		checkTeamCoverage(pg, redis, horizon, team)
+	}
+}
+
+func checkTeamCoverage(pg *sql.DB, redis *redis.Client, horizon time.Duration, team db.Team) {
+	now := time.Now()
+	report, err := services.NewCoverageService(pg, redis).Coverage(now, now.Add(horizon), "", team.ID)
+	if err != nil {
+		log.Printf("Coverage worker: failed to compute coverage: %v", err)
+		return
+	}
+
+	scope, who := "all", "No rotation or schedule"
+	if team.ID != "" {
+		scope, who = team.ID, fmt.Sprintf("No rotation or schedule of team %s", team.Name)
+	}
+
+	for _, gap := range report.Gaps {
+		// A gap that already started has a moving start, key it as current
+		key := fmt.Sprintf("coverage:gap:%s:%d", scope, gap.Start.Unix())
+		if !gap.Start.After(now) {
+			key = fmt.Sprintf("coverage:gap:%s:current", scope)
+		}
+		// Remind again once the horizon passed if the gap is still open-ended
+		ttl := gap.End.Sub(now) + horizon
+		if ok, err := redis.SetNX(context.Background(), key, gap.End.Unix(), ttl).Result(); err != nil || !ok {
+			continue
+		}
+
+		alert := db.Alert{
+			Title:       fmt.Sprintf("[COVERAGE] Nobody on call from %s", gap.Start.UTC().Format("2006-01-02 15:04 MST")),
+			Description: fmt.Sprintf("%s covers %s to %s. Alerts in this window will not be assigned to anyone.", who, gap.Start.UTC().Format(time.RFC3339), gap.End.UTC().Format(time.RFC3339)),
+			Status:      db.AlertStatusNew,
+			Severity:    "high",
+			Source:      "coverage_monitor",
+			TeamID:      team.ID,
+		}
+		if _, err := services.NewAlertService(pg, redis).CreateAlert(&alert); err != nil {
+			log.Printf("Coverage worker: failed to raise gap alert: %v", err)
+			redis.Del(context.Background(), key)
+			continue
+		}
+		log.Printf("Coverage worker: raised alert %s for gap %s - %s (%s)", alert.ID, gap.Start.UTC(), gap.End.UTC(), scope)
+	}
+}
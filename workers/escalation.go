@@ -0,0 +1,328 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vanchonlee/oncallkit/db"
+	"github.com/vanchonlee/oncallkit/notifier"
+	"github.com/vanchonlee/oncallkit/services"
+)
+
+// jobBatchSize is how many due jobs a worker claims per tick. Each job may
+// page several users over slow providers, the batch is kept small so that
+// few jobs wait on the ones before them.
+const jobBatchSize = 20
+
+// StartEscalationWorker runs due escalation jobs from the durable scheduler.
+// Any number of instances can run side by side.
+func StartEscalationWorker(pg *sql.DB, redis *redis.Client, dispatcher *notifier.Dispatcher) {
+	log.Println("Escalation worker started, waiting for due jobs...")
+
+	scheduler := services.NewJobScheduler(redis)
+	notificationService := services.NewNotificationService(pg, redis, dispatcher)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+
+		if n, err := scheduler.RequeueStale(ctx); err != nil {
+			log.Printf("Escalation worker: failed to requeue stale jobs: %v", err)
+		} else if n > 0 {
+			log.Printf("Escalation worker: requeued %d stale jobs", n)
+		}
+
+		jobs, err := scheduler.ClaimDue(ctx, jobBatchSize)
+		if err != nil {
+			log.Printf("Escalation worker: failed to claim due jobs: %v", err)
+			continue
+		}
+
+		for _, job := range jobs {
+			// Earlier jobs of the batch may have used up the claim's lease
+			if held, err := scheduler.Renew(ctx, &job); err != nil {
+				log.Printf("Escalation worker: failed to renew lease of job %s, leaving it: %v", job.ID, err)
+				continue
+			} else if !held {
+				log.Printf("Escalation worker: lease of job %s ran out, another worker has it", job.ID)
+				continue
+			}
+
+			switch job.Type {
+			case services.JobTypeEscalation:
+				processEscalationJob(pg, redis, scheduler, notificationService, job)
+			case services.JobTypeNotificationRule:
+				processNotificationRuleJob(pg, redis, notificationService, job)
+			case services.JobTypeNotificationRetry:
+				processNotificationRetryJob(pg, redis, notificationService, job)
+			case services.JobTypeSnoozeExpiry:
+				processSnoozeJob(pg, redis, notificationService, job)
+			case services.JobTypePage:
+				processPageJob(pg, redis, notificationService, job)
+			default:
+				log.Printf("Escalation worker: unknown job type %s (%s)", job.Type, job.ID)
+			}
+			if err := scheduler.Complete(ctx, job.ID); err != nil {
+				log.Printf("Escalation worker: failed to complete job %s: %v", job.ID, err)
+			}
+		}
+	}
+}
+
+// startEscalation notifies the first level of an alert's policy and schedules
+// the escalation job that fires when its delay runs out
+func startEscalation(pg *sql.DB, redis *redis.Client, notificationService *services.NotificationService, alert db.Alert) {
+	alertService := services.NewAlertService(pg, redis)
+	escalationService := services.NewEscalationService(pg, redis)
+
+	// Resolve the escalation policy if the alert was queued without one
+	policyID := alert.EscalationPolicyID
+	if policyID == "" {
+		var err error
+		policyID, err = escalationService.FindPolicyForAlert(alert.Source, "", alert.TeamID)
+		if err != nil {
+			log.Printf("Worker: failed to resolve escalation policy for alert %s: %v", alert.ID, err)
+		}
+	}
+
+	level, err := alertService.StartEscalation(alert.ID, policyID)
+	if err != nil {
+		log.Printf("Worker: failed to start escalation for alert %s: %v", alert.ID, err)
+		return
+	}
+	notifyEscalationLevel(escalationService, notificationService, alert, level)
+	log.Printf("Worker: level %d escalation check for alert %s in %d minutes", level.LevelNumber, alert.ID, level.DelayMinutes)
+}
+
+// processEscalationJob runs when a level's delay expired without an ACK.
+// The level is repeated repeat_count times before moving to the next one.
+// A job for level 0 is a new or reopened alert, which starts paging.
+func processEscalationJob(pg *sql.DB, redis *redis.Client, scheduler *services.JobScheduler, notificationService *services.NotificationService, job services.ScheduledJob) {
+	alertService := services.NewAlertService(pg, redis)
+	escalationService := services.NewEscalationService(pg, redis)
+
+	current, err := alertService.GetAlert(job.AlertID)
+	if err == sql.ErrNoRows {
+		log.Printf("Worker: dropping escalation for missing alert %s", job.AlertID)
+		return
+	} else if err != nil {
+		log.Printf("Worker: failed to load alert %s, retrying: %v", job.AlertID, err)
+		job.DueAt = time.Now().Add(30 * time.Second)
+		scheduler.Schedule(context.Background(), job)
+		return
+	}
+	if !services.AlertIsPaging(current.Status) {
+		log.Printf("Worker: alert %s is %s, stopping escalation", current.ID, current.Status)
+		return
+	}
+
+	alert := services.AlertFromResponse(current)
+	if job.Level == 0 {
+		log.Printf("Worker: processing alert %s", alert.ID)
+		startEscalation(pg, redis, notificationService, alert)
+		return
+	}
+	policyID := current.EscalationPolicyID
+
+	level, err := escalationService.GetLevel(policyID, job.Level)
+	if err != nil {
+		log.Printf("Worker: failed to load escalation level %d for alert %s: %v", job.Level, alert.ID, err)
+		return
+	}
+
+	if job.Attempt < level.RepeatCount {
+		log.Printf("Worker: repeating level %d notification for alert %s (%d/%d)", level.LevelNumber, alert.ID, job.Attempt+1, level.RepeatCount)
+		notifyEscalationLevel(escalationService, notificationService, alert, level)
+		if err := alertService.ScheduleEscalation(alert.ID, level, job.Attempt+1); err != nil {
+			log.Printf("Worker: failed to schedule escalation for alert %s: %v", alert.ID, err)
+		}
+		return
+	}
+
+	next, err := escalationService.GetLevel(policyID, level.LevelNumber+1)
+	if err == sql.ErrNoRows {
+		// Last level timed out, nobody left to escalate to
+		log.Printf("Worker: escalation policy exhausted for alert %s at level %d", alert.ID, level.LevelNumber)
+		if err := alertService.ExhaustEscalation(alert.ID); err != nil {
+			log.Printf("Worker: failed to update alert %s status to escalated: %v", alert.ID, err)
+		}
+		return
+	} else if err != nil {
+		log.Printf("Worker: failed to load escalation level %d for alert %s: %v", level.LevelNumber+1, alert.ID, err)
+		return
+	}
+
+	log.Printf("Worker: escalating alert %s to level %d (no ACK after %d minutes)", alert.ID, next.LevelNumber, level.DelayMinutes)
+	escalated, err := alertService.EscalateAlert(alert.ID, next)
+	if err != nil {
+		log.Printf("Worker: failed to escalate alert %s: %v", alert.ID, err)
+		return
+	}
+	if !escalated {
+		log.Printf("Worker: alert %s stopped paging meanwhile, stopping escalation", alert.ID)
+		return
+	}
+	notifyEscalationLevel(escalationService, notificationService, alert, next)
+}
+
+// processNotificationRuleJob fires a delayed notification rule ("SMS after
+// 2 minutes") unless the alert stopped paging in the meantime
+func processNotificationRuleJob(pg *sql.DB, redis *redis.Client, notificationService *services.NotificationService, job services.ScheduledJob) {
+	alertService := services.NewAlertService(pg, redis)
+	userService := services.NewUserService(pg, redis)
+	ruleService := services.NewNotificationRuleService(pg, redis, notificationService.Dispatcher)
+
+	current, err := alertService.GetAlert(job.AlertID)
+	if err != nil {
+		log.Printf("Worker: dropping notification rule %s, alert %s not loaded: %v", job.RuleID, job.AlertID, err)
+		return
+	}
+	if !services.AlertIsPaging(current.Status) {
+		return
+	}
+
+	user, err := userService.GetUser(job.UserID)
+	if err != nil || !user.IsActive {
+		log.Printf("Worker: dropping notification rule %s, user %s unavailable", job.RuleID, job.UserID)
+		return
+	}
+	rule, err := ruleService.GetRule(job.UserID, job.RuleID)
+	if err != nil || !rule.IsActive {
+		log.Printf("Worker: dropping notification rule %s, rule removed or disabled", job.RuleID)
+		return
+	}
+
+	alert := services.AlertFromResponse(current)
+	notificationService.NotifyRule(alert, user, rule, job.Level)
+}
+
+// processNotificationRetryJob retries a failed delivery. Retries stop once
+// the alert is acked, resolved or closed, nobody needs the page anymore.
+func processNotificationRetryJob(pg *sql.DB, redis *redis.Client, notificationService *services.NotificationService, job services.ScheduledJob) {
+	alertService := services.NewAlertService(pg, redis)
+
+	current, err := alertService.GetAlert(job.AlertID)
+	if err != nil {
+		log.Printf("Worker: dropping %s retry, alert %s not loaded: %v", job.Channel, job.AlertID, err)
+		return
+	}
+	if !services.AlertIsPaging(current.Status) {
+		log.Printf("Worker: alert %s is %s, dropping %s retry", current.ID, current.Status, job.Channel)
+		return
+	}
+
+	if _, err := notificationService.Redeliver(services.AlertFromResponse(current), job.UserID, job.RuleID, job.Channel, job.Level, job.Attempt); err != nil {
+		log.Printf("Worker: dropping %s retry for alert %s: %v", job.Channel, job.AlertID, err)
+	}
+}
+
+// processSnoozeJob reopens an alert whose snooze ran out and notifies its
+// assignee again, or the targets of its current level when it has none
+func processSnoozeJob(pg *sql.DB, redis *redis.Client, notificationService *services.NotificationService, job services.ScheduledJob) {
+	alertService := services.NewAlertService(pg, redis)
+	escalationService := services.NewEscalationService(pg, redis)
+
+	if _, err := alertService.WakeAlert(job.AlertID); errors.Is(err, services.ErrInvalidTransition) || err == sql.ErrNoRows {
+		log.Printf("Worker: alert %s is no longer snoozed, dropping snooze expiry", job.AlertID)
+		return
+	} else if err != nil {
+		log.Printf("Worker: failed to wake alert %s, retrying: %v", job.AlertID, err)
+		job.DueAt = time.Now().Add(30 * time.Second)
+		services.NewJobScheduler(redis).Schedule(context.Background(), job)
+		return
+	}
+
+	current, err := alertService.GetAlert(job.AlertID)
+	if err != nil {
+		log.Printf("Worker: failed to load woken alert %s: %v", job.AlertID, err)
+		return
+	}
+	if current.ParentID != "" {
+		log.Printf("Worker: snooze of alert %s ended, paged through parent alert %s", current.ID, current.ParentID)
+		return
+	}
+	alert := services.AlertFromResponse(current)
+	log.Printf("Worker: snooze of alert %s ended, notifying again", alert.ID)
+
+	levelNumber := alert.EscalationLevel
+	if levelNumber < 1 {
+		levelNumber = 1
+	}
+	if alert.AssignedTo != "" {
+		user, err := services.NewUserService(pg, redis).GetUser(alert.AssignedTo)
+		if err == nil && user.IsActive {
+			notificationService.NotifyUser(alert, user, levelNumber)
+			return
+		}
+	}
+
+	level, err := escalationService.GetLevel(alert.EscalationPolicyID, levelNumber)
+	if err != nil {
+		log.Printf("Worker: failed to load escalation level %d for alert %s: %v", levelNumber, alert.ID, err)
+		return
+	}
+	notifyEscalationLevel(escalationService, notificationService, alert, level)
+}
+
+// processPageJob pages the user of an assign or responder action, or the
+// targets of the level an alert was escalated to by hand
+func processPageJob(pg *sql.DB, redis *redis.Client, notificationService *services.NotificationService, job services.ScheduledJob) {
+	current, err := services.NewAlertService(pg, redis).GetAlert(job.AlertID)
+	if err != nil {
+		log.Printf("Worker: dropping page, alert %s not loaded: %v", job.AlertID, err)
+		return
+	}
+	if current.Status == db.AlertStatusResolved || current.Status == db.AlertStatusClosed {
+		log.Printf("Worker: alert %s is %s, dropping page", current.ID, current.Status)
+		return
+	}
+	alert := services.AlertFromResponse(current)
+
+	levelNumber := job.Level
+	if levelNumber < 1 {
+		levelNumber = max(alert.EscalationLevel, 1)
+	}
+	if job.UserID != "" {
+		user, err := services.NewUserService(pg, redis).GetUser(job.UserID)
+		if err != nil || !user.IsActive {
+			log.Printf("Worker: dropping page of alert %s, user %s unavailable", alert.ID, job.UserID)
+			return
+		}
+		log.Printf("Worker: paging %s (%s) on alert %s", user.Name, user.ID, alert.ID)
+		notificationService.NotifyUser(alert, user, levelNumber)
+		return
+	}
+
+	escalationService := services.NewEscalationService(pg, redis)
+	level, err := escalationService.GetLevel(alert.EscalationPolicyID, levelNumber)
+	if err != nil {
+		log.Printf("Worker: failed to load escalation level %d for alert %s: %v", levelNumber, alert.ID, err)
+		return
+	}
+	notifyEscalationLevel(escalationService, notificationService, alert, level)
+}
+
+func notifyEscalationLevel(escalationService *services.EscalationService, notificationService *services.NotificationService, alert db.Alert, level db.EscalationLevel) {
+	// Shared channels see every level, even when nobody can be paged
+	notificationService.NotifyBroadcast(alert, level.LevelNumber)
+
+	users, err := escalationService.ResolveTargets(level, alert.TeamID)
+	if err != nil {
+		log.Printf("Worker: failed to resolve level %d targets for alert %s: %v", level.LevelNumber, alert.ID, err)
+		return
+	}
+	if len(users) == 0 {
+		log.Printf("Worker: level %d (%s %s) has nobody to notify for alert %s", level.LevelNumber, level.TargetType, level.TargetID, alert.ID)
+		return
+	}
+
+	for _, user := range users {
+		log.Printf("Worker: notifying %s (%s) of alert %s at level %d", user.Name, user.ID, alert.ID, level.LevelNumber)
+		notificationService.NotifyUser(alert, user, level.LevelNumber)
+	}
+}